@@ -0,0 +1,182 @@
+// Package clientip resolves the address of the client behind load balancers and
+// CDNs. Forwarding headers are only believed when the connection comes from a
+// trusted proxy, and only the one header the deployment chose, since any
+// caller can send any of them.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers the client address can be read from.
+const (
+	// XForwardedFor and Forwarded (RFC 7239) list every hop, the client first;
+	// the client is the rightmost address that is not a trusted proxy.
+	XForwardedFor = "X-Forwarded-For"
+	Forwarded     = "Forwarded"
+	// XRealIP, CFConnectingIP (Cloudflare) and TrueClientIP (Akamai, Cloudflare
+	// Enterprise) carry the single address the trusted proxy saw.
+	XRealIP        = "X-Real-IP"
+	CFConnectingIP = "CF-Connecting-IP"
+	TrueClientIP   = "True-Client-IP"
+)
+
+// contextKey is where Middleware stores the Client in the gin context.
+const contextKey = "clientip.client"
+
+// Client is the resolved address of a request.
+type Client struct {
+	// IP is the address of the client, or of the closest untrusted hop.
+	IP string
+	// Chain is every hop as received, the client first and the peer of the connection last.
+	Chain []string
+}
+
+// Resolver resolves the client address of requests.
+type Resolver struct {
+	proxies []netip.Prefix
+	header  string
+}
+
+// NewResolver returns a Resolver believing header, one of the header constants,
+// on connections from proxies. With no proxies or no header the peer of the
+// connection is the client.
+func NewResolver(proxies []netip.Prefix, header string) *Resolver {
+	return &Resolver{proxies: proxies, header: http.CanonicalHeaderKey(header)}
+}
+
+// Resolve returns the client of req.
+func (r *Resolver) Resolve(req *http.Request) Client {
+	peer := remoteIP(req.RemoteAddr)
+	if r.header == "" || !r.trusted(peer) {
+		return Client{IP: peer, Chain: []string{peer}}
+	}
+
+	var hops []string
+	switch r.header {
+	case XForwardedFor:
+		for _, value := range req.Header.Values(XForwardedFor) {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	case Forwarded:
+		hops = forwardedFor(req.Header.Values(Forwarded))
+	default:
+		if value := strings.TrimSpace(req.Header.Get(r.header)); value != "" {
+			hops = []string{value}
+		}
+	}
+	chain := append(hops, peer)
+
+	// walk back from the peer over the trusted proxies; the first other hop is the client
+	client := peer
+	for i := len(chain) - 2; i >= 0; i-- {
+		ip, ok := parseIP(chain[i])
+		if !ok {
+			break
+		}
+		client = ip.String()
+		if !r.trusted(ip.String()) {
+			break
+		}
+	}
+	return Client{IP: client, Chain: chain}
+}
+
+// trusted reports whether ip is one of the trusted proxies.
+func (r *Resolver) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range r.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware resolves the client of every request, see Get.
+func (r *Resolver) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, r.Resolve(c.Request))
+		c.Next()
+	}
+}
+
+// Get returns the client resolved by Middleware, or the peer of the connection
+// when the request did not go through it.
+func Get(c *gin.Context) Client {
+	if client, ok := c.Get(contextKey); ok {
+		return client.(Client)
+	}
+	peer := remoteIP(c.Request.RemoteAddr)
+	return Client{IP: peer, Chain: []string{peer}}
+}
+
+// ParseProxies parses a comma separated list of CIDRs and addresses, e.g. "10.0.0.0/8,192.0.2.1".
+func ParseProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// forwardedFor returns the for= parameters of Forwarded header values, in order.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, hop, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(hop, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseIP parses a hop, which may carry a port and, for IPv6, brackets.
+func parseIP(hop string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	return addr.Unmap(), err == nil
+}
+
+// remoteIP returns the address of http.Request.RemoteAddr without its port.
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
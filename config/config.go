@@ -1,81 +1,598 @@
 package config
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"we-credit/clientip"
+	"we-credit/logging"
 
 	_ "github.com/lib/pq" //import postgres driver
 )
 
-// DB db object
-var DB *sql.DB
+var logger = logging.For("config")
+
+// Config is the typed configuration of the whole application. It is loaded
+// once at startup by Load and passed to the router, services and repositories.
+type Config struct {
+	Server      ServerConfig      `file:"server"`
+	DB          DBConfig          `file:"db"`
+	Outbox      OutboxConfig      `file:"outbox"`
+	Twilio      TwilioConfig      `file:"twilio"`
+	Auth        AuthConfig        `file:"auth"`
+	Log         LogConfig         `file:"log"`
+	Tracing     TracingConfig     `file:"tracing"`
+	Admin       AdminConfig       `file:"admin"`
+	OpenAPI     OpenAPIConfig     `file:"openapi"`
+	Idempotency IdempotencyConfig `file:"idempotency"`
+	Security    SecurityConfig    `file:"security"`
+	GeoIP       GeoIPConfig       `file:"geoip"`
+}
+
+// ServerConfig represents the http server configuration
+type ServerConfig struct {
+	Port    int    `env:"PORT" file:"port" required:"true"`
+	Env     string `env:"ENV" file:"env"`
+	GinMode string `env:"GIN_MODE" file:"gin_mode"`
+	// Host is the domain the auth cookie is set for.
+	Host    string `env:"HOST" file:"host"`
+	HostURL string `env:"HOST_URL" file:"host_url"`
+	// LocalIP replaces the client ip when Env is "local", so GeoIP lookups work on a dev machine.
+	LocalIP string `env:"LOCAL_IP" file:"local_ip"`
+	// TrustedProxies is the comma separated list of CIDRs and addresses of the load
+	// balancers and CDN in front of the server; only they may set ClientIPHeader.
+	TrustedProxies string `env:"SERVER_TRUSTED_PROXIES" file:"trusted_proxies"`
+	// ClientIPHeader is the header the trusted proxies pass the client address in:
+	// X-Forwarded-For, Forwarded, X-Real-IP, CF-Connecting-IP or True-Client-IP.
+	// Empty uses the address of the connection.
+	ClientIPHeader string `env:"SERVER_CLIENT_IP_HEADER" file:"client_ip_header"`
+	// DomainName is appended to the OTP SMS for WebOTP autofill.
+	DomainName string `env:"DOMAIN_NAME" file:"domain_name"`
+
+	// http.Server limits, they keep slow or idle clients from holding connections forever.
+	ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT" file:"read_timeout"`
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" file:"read_header_timeout"`
+	WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT" file:"write_timeout"`
+	IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT" file:"idle_timeout"`
+	MaxHeaderBytes    int           `env:"SERVER_MAX_HEADER_BYTES" file:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests and queued SMS get to drain on SIGTERM/SIGINT.
+	ShutdownTimeout time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" file:"shutdown_timeout"`
+	// ReadinessTimeout bounds the dependency checks behind /readyz.
+	ReadinessTimeout time.Duration `env:"SERVER_READINESS_TIMEOUT" file:"readiness_timeout"`
+}
+
+// ClientIPResolver returns the resolver of client addresses described by the configuration.
+func (server ServerConfig) ClientIPResolver() (*clientip.Resolver, error) {
+	proxies, err := clientip.ParseProxies(server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return clientip.NewResolver(proxies, server.ClientIPHeader), nil
+}
+
+// IsLocal reports whether the server runs on a developer machine.
+func (server ServerConfig) IsLocal() bool {
+	return server.Env == "local"
+}
 
 // DBConfig represents db configuration
 type DBConfig struct {
-	Host     string
-	Port     int64
-	User     string
-	DBName   string
-	DBName2  string
-	Password string
+	Host   string `env:"DBHOST" file:"host" required:"true"`
+	Port   int64  `env:"DBPORT" file:"port"`
+	User   string `env:"DBUSER" file:"user" required:"true"`
+	DBName string `env:"DBNAME" file:"name" required:"true"`
+	// DBName2 names the read replica database, see Replica.
+	DBName2  string `env:"DBNAME2" file:"name2"`
+	Password string `env:"DBPASS" file:"password"`
+	// PasswordFile is read instead of Password when set, e.g. a mounted Kubernetes secret.
+	PasswordFile string `env:"DBPASS_FILE" file:"password_file"`
+
+	// TLS and connection settings, see https://www.postgresql.org/docs/current/libpq-connect.html
+	SSLMode         string        `env:"DB_SSLMODE" file:"sslmode"`
+	SSLRootCert     string        `env:"DB_SSLROOTCERT" file:"sslrootcert"`
+	SSLCert         string        `env:"DB_SSLCERT" file:"sslcert"`
+	SSLKey          string        `env:"DB_SSLKEY" file:"sslkey"`
+	ConnectTimeout  time.Duration `env:"DB_CONNECT_TIMEOUT" file:"connect_timeout"`
+	ApplicationName string        `env:"DB_APPLICATION_NAME" file:"application_name"`
+	SearchPath      string        `env:"DB_SEARCH_PATH" file:"search_path"`
+
+	// Pool settings applied to the shared connection pool.
+	MaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" file:"max_open_conns"`
+	MaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" file:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" file:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" file:"conn_max_idle_time"`
+
+	// QueryTimeout bounds every single query; zero disables the limit.
+	QueryTimeout time.Duration `env:"DB_QUERY_TIMEOUT" file:"query_timeout"`
+
+	// Read replica, enabled when DBName2 or ReplicaHost is set. Reads fall back
+	// to the primary while the replica is unreachable or lags more than ReplicaMaxLag.
+	ReplicaHost          string        `env:"DB_REPLICA_HOST" file:"replica_host"`
+	ReplicaPort          int64         `env:"DB_REPLICA_PORT" file:"replica_port"`
+	ReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG" file:"replica_max_lag"`
+	ReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" file:"replica_check_interval"`
 }
 
-// BuildDBConfig builds db config object from environment variables
-func BuildDBConfig() DBConfig {
+// HasReplica reports whether a read replica is configured.
+func (dbConfig DBConfig) HasReplica() bool {
+	return dbConfig.DBName2 != "" || dbConfig.ReplicaHost != ""
+}
 
-	port, _ := strconv.ParseInt(os.Getenv("DBPORT"), 10, 0)
+// Replica returns the configuration of the read replica. Settings that are not
+// specific to the replica (credentials, TLS, pool limits) are shared with the primary.
+func (dbConfig DBConfig) Replica() DBConfig {
+	replica := dbConfig
+	if dbConfig.ReplicaHost != "" {
+		replica.Host = dbConfig.ReplicaHost
+	}
+	if dbConfig.ReplicaPort != 0 {
+		replica.Port = dbConfig.ReplicaPort
+	}
+	if dbConfig.DBName2 != "" {
+		replica.DBName = dbConfig.DBName2
+	}
+	return replica
+}
 
-	dbConfig := DBConfig{
-		Host:     os.Getenv("DBHOST"),
-		Port:     port,
-		User:     os.Getenv("DBUSER"),
-		DBName:   os.Getenv("DBNAME"),
-		Password: os.Getenv("DBPASS"),
+// OutboxConfig represents the settings of the sms outbox dispatcher
+type OutboxConfig struct {
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" file:"poll_interval"`
+	BatchSize    int           `env:"OUTBOX_BATCH_SIZE" file:"batch_size"`
+	MaxAttempts  int           `env:"OUTBOX_MAX_ATTEMPTS" file:"max_attempts"`
+}
+
+// TwilioConfig represents the credentials used for phone lookups and sending SMS
+type TwilioConfig struct {
+	AccountSID string `env:"TWILIO_ACCOUNT_SID" file:"account_sid" required:"true"`
+	AuthToken  string `env:"TWILIO_ACCOUNT_AUTH_TOKEN" file:"auth_token" required:"true"`
+	FromNumber string `env:"TWILIO_FROM_NUMBER" file:"from_number" required:"true"`
+	// AllowVoipNumbers skips the VoIP lookup during registration when true.
+	AllowVoipNumbers bool `env:"ALLOW_VOIP_NUMBERS" file:"allow_voip_numbers"`
+}
+
+// AuthConfig represents the settings used to issue session tokens
+type AuthConfig struct {
+	JWTSecretKey string `env:"JWT_SECRET_KEY" file:"jwt_secret_key" required:"true"`
+
+	// Attributes of the session cookie. Secure cookies are only sent over https
+	// (and http://localhost), HttpOnly ones are hidden from JavaScript.
+	CookieName     string `env:"AUTH_COOKIE_NAME" file:"cookie_name"`
+	CookieSecure   bool   `env:"AUTH_COOKIE_SECURE" file:"cookie_secure"`
+	CookieHTTPOnly bool   `env:"AUTH_COOKIE_HTTP_ONLY" file:"cookie_http_only"`
+	// CookieSameSite is lax, strict or none.
+	CookieSameSite string `env:"AUTH_COOKIE_SAMESITE" file:"cookie_samesite"`
+	// CookieHostPrefix names the cookie "__Host-<name>", which browsers only accept
+	// when it is Secure, for the path / and without a domain, i.e. bound to this host.
+	CookieHostPrefix bool `env:"AUTH_COOKIE_HOST_PREFIX" file:"cookie_host_prefix"`
+
+	// TrustedOrigins is the comma separated list of origins, e.g. "https://app.example.com",
+	// allowed to send state-changing requests with the session cookie besides HOST_URL and the API host itself.
+	TrustedOrigins string `env:"AUTH_TRUSTED_ORIGINS" file:"trusted_origins"`
+}
+
+// Cookie returns the name of the session cookie, with its prefix.
+func (auth AuthConfig) Cookie() string {
+	if auth.CookieHostPrefix {
+		return "__Host-" + auth.CookieName
 	}
-	return dbConfig
+	return auth.CookieName
 }
 
-// DbURL get db connection string
-func (dbConfig DBConfig) DbURL() string {
-	return fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Password, dbConfig.DBName)
+// SameSite returns the SameSite attribute of the session cookie.
+func (auth AuthConfig) SameSite() http.SameSite {
+	switch auth.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
 }
 
-func openDB() {
-	var err error
-	DB, err = sql.Open("postgres", BuildDBConfig().DbURL())
+// LogConfig configures the structured logs.
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string `env:"LOG_LEVEL" file:"level"`
+	// Packages overrides Level per package, e.g. "repository=debug,outbox=warn".
+	Packages string `env:"LOG_LEVELS" file:"packages"`
+	// RedactPII masks phone numbers, OTPs, tokens and IPs. Only disable it on a developer machine.
+	RedactPII bool `env:"LOG_REDACT_PII" file:"redact_pii"`
+}
+
+// Options returns the logging options described by the configuration.
+func (logConfig LogConfig) Options() (logging.Options, error) {
+	level, packages, err := logging.ParseLevels(logConfig.Level, logConfig.Packages)
 	if err != nil {
-		log.Println("db connect error")
-		log.Println("openDB: failed:", err)
-		return
+		return logging.Options{}, err
+	}
+	opts := logging.Options{Level: level, Packages: packages}
+	if logConfig.RedactPII {
+		opts.Policy = logging.DefaultPolicy()
+	}
+	return opts, nil
+}
+
+// TracingConfig configures the OpenTelemetry traces.
+type TracingConfig struct {
+	// Exporter is where spans are sent: none, stdout (for local runs) or otlp.
+	Exporter string `env:"TRACING_EXPORTER" file:"exporter"`
+	// OTLPEndpoint is the host:port of the OTLP/HTTP collector. When empty the
+	// standard OTEL_EXPORTER_OTLP_* environment variables apply.
+	OTLPEndpoint string `env:"TRACING_OTLP_ENDPOINT" file:"otlp_endpoint"`
+	OTLPInsecure bool   `env:"TRACING_OTLP_INSECURE" file:"otlp_insecure"`
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1.
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" file:"sample_ratio"`
+	ServiceName string  `env:"TRACING_SERVICE_NAME" file:"service_name"`
+}
+
+// AdminConfig configures the admin listener serving pprof, swagger, metrics and
+// the admin APIs, kept off the public port.
+type AdminConfig struct {
+	// Addr is the address the admin listener binds to; empty disables it.
+	Addr string `env:"ADMIN_ADDR" file:"addr"`
+	// Username and Password enable basic auth, Token enables "Authorization: Bearer <token>".
+	// Either is accepted when both are set; with neither the listener is open to anyone who can reach it.
+	Username string `env:"ADMIN_USERNAME" file:"username"`
+	Password string `env:"ADMIN_PASSWORD" file:"password"`
+	Token    string `env:"ADMIN_TOKEN" file:"token"`
+}
+
+// HasAuth reports whether requests to the admin listener must authenticate.
+func (admin AdminConfig) HasAuth() bool {
+	return admin.Username != "" || admin.Token != ""
+}
+
+// OpenAPIConfig configures the validation of the public API against its OpenAPI document.
+type OpenAPIConfig struct {
+	// Validation is what happens to requests that do not match the document: off, log or enforce.
+	Validation string `env:"OPENAPI_VALIDATION" file:"validation"`
+	// ValidateResponses logs the responses that do not match the document. It
+	// buffers every response body, so it is meant for development and CI.
+	ValidateResponses bool `env:"OPENAPI_VALIDATE_RESPONSES" file:"validate_responses"`
+}
+
+// IdempotencyConfig configures how long responses are replayed to retries made with an Idempotency-Key header.
+type IdempotencyConfig struct {
+	// TTL is the window, from the first request, in which retries get the stored
+	// response. It should not exceed the OTP validity, or retries get a stale challenge.
+	TTL time.Duration `env:"IDEMPOTENCY_TTL" file:"ttl"`
+	// CleanupInterval is how often expired keys are deleted.
+	CleanupInterval time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL" file:"cleanup_interval"`
+}
+
+// SecurityConfig configures the CORS and security headers answered to browsers.
+type SecurityConfig struct {
+	// CORSAllowedOrigins is the comma separated list of origins, e.g. "https://signup.example.com",
+	// allowed to call the API from a browser; "*" allows any origin but not with credentials.
+	CORSAllowedOrigins string `env:"CORS_ALLOWED_ORIGINS" file:"cors_allowed_origins"`
+	// CORSAllowCredentials lets those origins send and receive the session cookie.
+	CORSAllowCredentials bool `env:"CORS_ALLOW_CREDENTIALS" file:"cors_allow_credentials"`
+	// CORSMaxAge is how long browsers may cache a preflight response.
+	CORSMaxAge time.Duration `env:"CORS_MAX_AGE" file:"cors_max_age"`
+
+	// HeadersProfile is strict, basic (strict without HSTS, for plain http) or off.
+	// When empty it is basic for local runs and strict everywhere else.
+	HeadersProfile string `env:"SECURITY_HEADERS_PROFILE" file:"headers_profile"`
+	// HSTSMaxAge is how long browsers must only use https, with the strict profile.
+	HSTSMaxAge time.Duration `env:"SECURITY_HSTS_MAX_AGE" file:"hsts_max_age"`
+}
+
+// CORSOrigins returns the origins allowed to call the API from a browser.
+func (security SecurityConfig) CORSOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(security.CORSAllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
 	}
+	return origins
+}
 
-	err = DB.Ping()
+// Profile returns the security headers profile in effect for server.
+func (security SecurityConfig) Profile(server ServerConfig) string {
+	if security.HeadersProfile != "" {
+		return security.HeadersProfile
+	}
+	if server.IsLocal() {
+		return "basic"
+	}
+	return "strict"
+}
+
+// GeoIPConfig configures the MaxMind database used to locate client IPs.
+type GeoIPConfig struct {
+	// Path is the GeoLite2 or GeoIP2 City database.
+	Path string `env:"GEOIP_DATABASE_PATH" file:"database_path"`
+	// ASNPath is the GeoLite2 ASN database, AnonymousIPPath the GeoIP2 Anonymous IP
+	// database; they describe the network of an IP for fraud screening. Empty disables them.
+	ASNPath         string `env:"GEOIP_ASN_DATABASE_PATH" file:"asn_database_path"`
+	AnonymousIPPath string `env:"GEOIP_ANONYMOUS_IP_DATABASE_PATH" file:"anonymous_ip_database_path"`
+	// InMemory reads the databases in memory instead of memory mapping the files.
+	InMemory bool `env:"GEOIP_IN_MEMORY" file:"in_memory"`
+	// ReloadInterval is how often the file is checked for a new version; 0 disables reloading.
+	ReloadInterval time.Duration `env:"GEOIP_RELOAD_INTERVAL" file:"reload_interval"`
+	// CacheSize is how many looked up IPs are remembered; 0 disables the cache.
+	CacheSize int `env:"GEOIP_CACHE_SIZE" file:"cache_size"`
+}
+
+// defaults returns the configuration used for every setting that is neither in the config file nor in the environment.
+func defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   20 * time.Second,
+			ReadinessTimeout:  2 * time.Second,
+		},
+		DB: DBConfig{
+			Port:            5432,
+			SSLMode:         "disable",
+			ConnectTimeout:  10 * time.Second,
+			ApplicationName: "we-credit",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+
+			ReplicaMaxLag:        10 * time.Second,
+			ReplicaCheckInterval: 5 * time.Second,
+		},
+		Outbox: OutboxConfig{
+			PollInterval: time.Second,
+			BatchSize:    10,
+			MaxAttempts:  5,
+		},
+		Twilio: TwilioConfig{
+			AllowVoipNumbers: true,
+		},
+		Auth: AuthConfig{
+			CookieName:     "token",
+			CookieSecure:   true,
+			CookieHTTPOnly: true,
+			CookieSameSite: "lax",
+		},
+		Log: LogConfig{
+			Level:     "info",
+			RedactPII: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "we-credit",
+		},
+		Admin: AdminConfig{
+			Addr: "127.0.0.1:9090",
+		},
+		OpenAPI: OpenAPIConfig{
+			Validation: "off",
+		},
+		Security: SecurityConfig{
+			CORSMaxAge: 10 * time.Minute,
+			HSTSMaxAge: 365 * 24 * time.Hour,
+		},
+		GeoIP: GeoIPConfig{
+			Path:           "./db/GeoLite2-City.mmdb",
+			ReloadInterval: time.Minute,
+			CacheSize:      10000,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:             5 * time.Minute,
+			CleanupInterval: 10 * time.Minute,
+		},
+	}
+}
+
+// validate checks the constraints that go beyond a setting being present and well formed.
+func (cfg Config) validate() []string {
+	var problems []string
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT: %d is not a valid port", cfg.Server.Port))
+	}
+	if cfg.Server.MaxHeaderBytes < 1 {
+		problems = append(problems, "SERVER_MAX_HEADER_BYTES: must be positive")
+	}
+	if _, err := cfg.Server.ClientIPResolver(); err != nil {
+		problems = append(problems, fmt.Sprintf("SERVER_TRUSTED_PROXIES: %v", err))
+	}
+	switch http.CanonicalHeaderKey(cfg.Server.ClientIPHeader) {
+	case "", clientip.XForwardedFor, clientip.Forwarded, clientip.XRealIP, clientip.CFConnectingIP, clientip.TrueClientIP:
+	default:
+		problems = append(problems, fmt.Sprintf("SERVER_CLIENT_IP_HEADER: %q must be X-Forwarded-For, Forwarded, X-Real-IP, CF-Connecting-IP or True-Client-IP", cfg.Server.ClientIPHeader))
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "SERVER_SHUTDOWN_TIMEOUT: must be positive")
+	}
+	if cfg.Server.ReadinessTimeout <= 0 {
+		problems = append(problems, "SERVER_READINESS_TIMEOUT: must be positive")
+	}
+	if cfg.DB.Port < 1 || cfg.DB.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("DBPORT: %d is not a valid port", cfg.DB.Port))
+	}
+	problems = append(problems, cfg.DB.validateTLS()...)
+	switch cfg.Auth.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !cfg.Auth.CookieSecure {
+			problems = append(problems, "AUTH_COOKIE_SAMESITE: none requires AUTH_COOKIE_SECURE")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("AUTH_COOKIE_SAMESITE: %q must be lax, strict or none", cfg.Auth.CookieSameSite))
+	}
+	if cfg.Auth.CookieName == "" {
+		problems = append(problems, "AUTH_COOKIE_NAME: must not be empty")
+	}
+	if cfg.Auth.CookieHostPrefix && !cfg.Auth.CookieSecure {
+		problems = append(problems, "AUTH_COOKIE_HOST_PREFIX: requires AUTH_COOKIE_SECURE")
+	}
+	if _, err := cfg.Log.Options(); err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL, LOG_LEVELS: %v", err))
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("TRACING_EXPORTER: %q must be none, stdout or otlp", cfg.Tracing.Exporter))
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problems = append(problems, "TRACING_SAMPLE_RATIO: must be between 0 and 1")
+	}
+	switch cfg.OpenAPI.Validation {
+	case "off", "log", "enforce":
+	default:
+		problems = append(problems, fmt.Sprintf("OPENAPI_VALIDATION: %q must be off, log or enforce", cfg.OpenAPI.Validation))
+	}
+	switch cfg.Security.HeadersProfile {
+	case "", "strict", "basic", "off":
+	default:
+		problems = append(problems, fmt.Sprintf("SECURITY_HEADERS_PROFILE: %q must be strict, basic or off", cfg.Security.HeadersProfile))
+	}
+	if cfg.Security.CORSAllowCredentials && slices.Contains(cfg.Security.CORSOrigins(), "*") {
+		problems = append(problems, "CORS_ALLOWED_ORIGINS: * can not be used with CORS_ALLOW_CREDENTIALS")
+	}
+	if cfg.GeoIP.Path == "" {
+		problems = append(problems, "GEOIP_DATABASE_PATH: must not be empty")
+	}
+	if cfg.GeoIP.ReloadInterval < 0 || cfg.GeoIP.CacheSize < 0 {
+		problems = append(problems, "GEOIP_RELOAD_INTERVAL, GEOIP_CACHE_SIZE: must not be negative")
+	}
+	if cfg.Idempotency.TTL <= 0 || cfg.Idempotency.CleanupInterval <= 0 {
+		problems = append(problems, "IDEMPOTENCY_TTL, IDEMPOTENCY_CLEANUP_INTERVAL: must be positive")
+	}
+	if (cfg.Admin.Username == "") != (cfg.Admin.Password == "") {
+		problems = append(problems, "ADMIN_USERNAME, ADMIN_PASSWORD: must be set together")
+	}
+	if cfg.DB.MaxOpenConns < 0 || cfg.DB.MaxIdleConns < 0 {
+		problems = append(problems, "DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS: must not be negative")
+	}
+	if cfg.DB.HasReplica() && cfg.DB.ReplicaCheckInterval <= 0 {
+		problems = append(problems, "DB_REPLICA_CHECK_INTERVAL: must be positive")
+	}
+	if cfg.Outbox.PollInterval <= 0 {
+		problems = append(problems, "OUTBOX_POLL_INTERVAL: must be positive")
+	}
+	if cfg.Outbox.BatchSize < 1 || cfg.Outbox.MaxAttempts < 1 {
+		problems = append(problems, "OUTBOX_BATCH_SIZE, OUTBOX_MAX_ATTEMPTS: must be at least 1")
+	}
+	return problems
+}
+
+// sslModes are the sslmode values understood by the postgres driver.
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+// validateTLS checks the TLS settings and that every certificate file can be read.
+func (dbConfig DBConfig) validateTLS() []string {
+	var problems []string
+	if !sslModes[dbConfig.SSLMode] {
+		problems = append(problems, fmt.Sprintf("DB_SSLMODE: %q is not one of disable, allow, prefer, require, verify-ca, verify-full", dbConfig.SSLMode))
+	}
+	if (dbConfig.SSLCert == "") != (dbConfig.SSLKey == "") {
+		problems = append(problems, "DB_SSLCERT, DB_SSLKEY: client certificate and key must be set together")
+	}
+	for key, path := range map[string]string{"DB_SSLROOTCERT": dbConfig.SSLRootCert, "DB_SSLCERT": dbConfig.SSLCert, "DB_SSLKEY": dbConfig.SSLKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if dbConfig.ConnectTimeout < 0 {
+		problems = append(problems, "DB_CONNECT_TIMEOUT: must not be negative")
+	}
+	return problems
+}
+
+// readPasswordFile replaces Password with the content of PasswordFile, when set.
+func (dbConfig *DBConfig) readPasswordFile() []string {
+	if dbConfig.PasswordFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(dbConfig.PasswordFile)
 	if err != nil {
-		log.Println("openDB: failed:", err)
-		return
+		return []string{fmt.Sprintf("DBPASS_FILE: %v", err)}
 	}
+	// Secret files usually end with a newline that is not part of the password.
+	dbConfig.Password = strings.TrimRight(string(content), "\r\n")
+	return nil
 }
 
-// GetDB get db object
-func GetDB() *sql.DB {
-	if DB == nil {
-		openDB()
+// DbURL get db connection string. Every value is quoted and escaped, so
+// passwords and paths containing spaces, quotes or backslashes are safe.
+func (dbConfig DBConfig) DbURL() string {
+	params := []struct{ key, value string }{
+		{"host", dbConfig.Host},
+		{"port", strconv.FormatInt(dbConfig.Port, 10)},
+		{"user", dbConfig.User},
+		{"password", dbConfig.Password},
+		{"dbname", dbConfig.DBName},
+		{"sslmode", dbConfig.SSLMode},
+		{"sslrootcert", dbConfig.SSLRootCert},
+		{"sslcert", dbConfig.SSLCert},
+		{"sslkey", dbConfig.SSLKey},
+		{"application_name", dbConfig.ApplicationName},
+		{"search_path", dbConfig.SearchPath},
+	}
+	if dbConfig.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds, round up so that e.g. 500ms does not become "no timeout".
+		seconds := int64((dbConfig.ConnectTimeout + time.Second - 1) / time.Second)
+		params = append(params, struct{ key, value string }{"connect_timeout", strconv.FormatInt(seconds, 10)})
+	}
+
+	var dsn []string
+	for _, param := range params {
+		if param.value == "" {
+			continue
+		}
+		dsn = append(dsn, param.key+"="+quoteDSNValue(param.value))
 	}
-	return DB
+	return strings.Join(dsn, " ")
 }
 
-// GetDB2 same as getDB but returns an error when it cannot connect.
-func GetDB2() (*sql.DB, error) {
-	DB, err := sql.Open("postgres", BuildDBConfig().DbURL())
+// quoteDSNValue quotes a key=value connection string value, escaping backslashes and single quotes.
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// OpenDB creates the shared connection pool used by the whole application.
+// It applies the pool limits from dbConfig and pings the database so that a
+// misconfigured or unreachable database fails the boot instead of the first request.
+// The caller owns the returned pool and must close it on shutdown.
+func OpenDB(dbConfig DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dbConfig.DbURL())
 	if err != nil {
-		log.Println("GetDB2: Failed to connect to DB: " + err.Error())
-		return DB, err
+		logger.Error("OpenDB: failed to open connection pool", "error", err)
+		return nil, err
 	}
 
-	return DB, nil
+	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	db.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime)
+
+	ctx := context.Background()
+	if dbConfig.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dbConfig.ConnectTimeout)
+		defer cancel()
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		logger.Error("OpenDB: health check failed", "error", err)
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
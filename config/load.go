@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError lists every missing or malformed setting found while loading the configuration,
+// so that a broken deploy can be fixed in one go instead of one restart per setting.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the configuration once at startup. Settings are taken, from lowest to highest precedence, from:
+//   - the built in defaults,
+//   - the YAML (.yaml, .yml) or TOML (.toml) file named by the CONFIG_FILE environment variable, if set,
+//   - the environment, including an optional .env file in the working directory.
+//
+// Every problem found is collected and returned together as a *ValidationError.
+func Load() (Config, error) {
+	var problems []string
+
+	// .env is a convenience for local development, production sets real environment variables.
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf(".env: %v", err))
+	}
+
+	var file map[string]any
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err = readFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CONFIG_FILE: %v", err))
+		}
+	}
+
+	cfg := defaults()
+	problems = append(problems, populate(reflect.ValueOf(&cfg).Elem(), file, "")...)
+	problems = append(problems, cfg.DB.readPasswordFile()...)
+	if len(problems) == 0 {
+		problems = cfg.validate()
+	}
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML config file, picked by its extension, into nested maps.
+func readFile(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &file)
+	case ".toml":
+		err = toml.Unmarshal(content, &file)
+	default:
+		err = fmt.Errorf("%s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	return file, err
+}
+
+// populate fills the struct v from the config file section and the environment,
+// recursing into nested sections, and returns every problem it finds.
+func populate(v reflect.Value, section map[string]any, path string) []string {
+	var problems []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("file")
+		name := strings.TrimPrefix(path+"."+key, ".")
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			nested, _ := section[key].(map[string]any)
+			problems = append(problems, populate(v.Field(i), nested, name)...)
+			continue
+		}
+
+		envKey := field.Tag.Get("env")
+		raw, source, ok := "", "", false
+		if value, found := section[key]; found {
+			raw, source, ok = fmt.Sprint(value), name, true
+		}
+		if value := os.Getenv(envKey); value != "" {
+			raw, source, ok = value, envKey, true
+		}
+
+		if !ok {
+			if field.Tag.Get("required") == "true" {
+				problems = append(problems, fmt.Sprintf("%s (%s in the config file): is required", envKey, name))
+			}
+			continue
+		}
+		err := setValue(v.Field(i), raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q %v", source, raw, err))
+		}
+	}
+	return problems
+}
+
+// setValue parses raw into the field according to its type. Strings are kept
+// verbatim, since passwords may legitimately start or end with spaces.
+func setValue(field reflect.Value, raw string) error {
+	if field.Kind() != reflect.String {
+		raw = strings.TrimSpace(raw)
+	}
+	if field.Type() == durationType {
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("is not a valid duration (e.g. 30s, 5m)")
+		}
+		field.SetInt(int64(value))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("is not a valid integer")
+		}
+		field.SetInt(value)
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("is not a valid number")
+		}
+		field.SetFloat(value)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("is not a valid boolean")
+		}
+		field.SetBool(value)
+	default:
+		return fmt.Errorf("has unsupported type %s", field.Type())
+	}
+	return nil
+}
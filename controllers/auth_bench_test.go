@@ -0,0 +1,117 @@
+package controllers_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"we-credit/controllers"
+	"we-credit/repository"
+	"we-credit/routes"
+)
+
+// stubConnectLatency is what opening a connection to the stub database costs,
+// in the range of a Postgres in the same data center (TCP, TLS and SCRAM authentication).
+const stubConnectLatency = time.Millisecond
+
+// BenchmarkUserRegistration measures POST /api/v1/user/authenticate end to end
+// through the router:
+//   - memory: the in-memory repository, the cost of the handler alone;
+//   - shared-pool: the Postgres repository on one pool whose connections and
+//     prepared statements are reused across requests;
+//   - connection-per-query: the same repository on a pool that keeps no idle
+//     connection, so every query connects and prepares again, as when every
+//     query opened and closed its own pool.
+func BenchmarkUserRegistration(b *testing.B) {
+	b.Run("memory", func(b *testing.B) {
+		_, repos := memoryRepositories()
+		benchmarkRegistration(b, repos)
+	})
+	b.Run("postgres/shared-pool", func(b *testing.B) {
+		benchmarkPostgresRegistration(b, 25)
+	})
+	b.Run("postgres/connection-per-query", func(b *testing.B) {
+		benchmarkPostgresRegistration(b, 0)
+	})
+}
+
+// BenchmarkUserRegistrationPostgres is BenchmarkUserRegistration against the
+// Postgres of TEST_POSTGRES_DSN, a scratch database migrated to the latest
+// version, e.g. "host=localhost dbname=we_credit_bench sslmode=disable". It is
+// skipped when the variable is not set. Users are upserted on numbers starting
+// at 9000000000, so runs after the first refresh the OTP of existing users.
+func BenchmarkUserRegistrationPostgres(b *testing.B) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		b.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	b.Run("shared-pool", func(b *testing.B) {
+		benchmarkRealPostgresRegistration(b, dsn, 25)
+	})
+	b.Run("connection-per-query", func(b *testing.B) {
+		benchmarkRealPostgresRegistration(b, dsn, 0)
+	})
+}
+
+// benchmarkRealPostgresRegistration benchmarks registrations against the database
+// of dsn with a pool keeping at most maxIdle idle connections.
+func benchmarkRealPostgresRegistration(b *testing.B, dsn string, maxIdle int) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(maxIdle)
+	err = db.Ping()
+	if err != nil {
+		b.Fatal(err)
+	}
+	repo := repository.NewPostgres(db, 0)
+	defer repo.Close()
+
+	benchmarkRegistration(b, controllers.Repositories{
+		Users:         repo,
+		OTPs:          repo,
+		Sessions:      repo,
+		Countries:     repo,
+		Registrations: repo,
+	})
+}
+
+// benchmarkPostgresRegistration benchmarks registrations against the stub database
+// with a pool keeping at most maxIdle idle connections, and reports how many
+// connections every registration opened.
+func benchmarkPostgresRegistration(b *testing.B, maxIdle int) {
+	db, connector := openStubDB(stubConnectLatency, maxIdle)
+	defer db.Close()
+	repo := repository.NewPostgres(db, 0)
+	defer repo.Close()
+
+	benchmarkRegistration(b, controllers.Repositories{
+		Users:         repo,
+		OTPs:          repo,
+		Sessions:      repo,
+		Countries:     repo,
+		Registrations: repo,
+	})
+	b.ReportMetric(float64(connector.Opened())/float64(b.N), "conns/op")
+}
+
+func benchmarkRegistration(b *testing.B, repos controllers.Repositories) {
+	router := newRouter(testConfig(), repos, &fakePhones{}, routes.Middlewares{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recorder := do(router, http.MethodPost, "/api/v1/user/authenticate", map[string]string{
+			"phone_number": fmt.Sprintf("9%09d", i),
+		})
+		if recorder.Code != http.StatusOK {
+			b.Fatalf("authenticate answered %d: %s", recorder.Code, recorder.Body)
+		}
+	}
+}
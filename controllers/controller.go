@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"we-credit/config"
+	"we-credit/logging"
+	"we-credit/repository"
+	"we-credit/service"
+)
+
+var logger = logging.For("controllers")
+
+// PhoneService looks up phone numbers and sends SMS to them.
+// It is implemented by service.Twilio.
+type PhoneService interface {
+	IsPhNumberDeliverable(ctx context.Context, phone, countrycode string) (bool, error)
+	IsPhoneNumberVoip(ctx context.Context, phone, countrycode string) (bool, error)
+	SendMessage(ctx context.Context, phone string, message string, dialingCode string) error
+}
+
+// LocationService locates client IPs, naming places in the first of languages available.
+type LocationService interface {
+	Lookup(ctx context.Context, ip string, languages ...string) service.Location
+}
+
+// Repositories groups the repositories the handlers read from and write to.
+type Repositories struct {
+	Users         repository.UserRepository
+	OTPs          repository.OTPRepository
+	Sessions      repository.SessionRepository
+	Countries     repository.CountryRepository
+	Registrations repository.RegistrationRepository
+}
+
+// Controller holds the dependencies shared by every HTTP handler.
+// Handlers are methods on Controller so that tests can build one with
+// in-memory repositories instead of a database.
+type Controller struct {
+	cfg       config.Config
+	phones    PhoneService
+	locations LocationService
+
+	users     repository.UserRepository
+	otps      repository.OTPRepository
+	sessions  repository.SessionRepository
+	countries repository.CountryRepository
+
+	registrations repository.RegistrationRepository
+}
+
+// NewController returns a Controller using the given configuration, repositories, phone and location services.
+func NewController(cfg config.Config, repos Repositories, phones PhoneService, locations LocationService) *Controller {
+	return &Controller{
+		cfg:           cfg,
+		phones:        phones,
+		locations:     locations,
+		users:         repos.Users,
+		otps:          repos.OTPs,
+		sessions:      repos.Sessions,
+		countries:     repos.Countries,
+		registrations: repos.Registrations,
+	}
+}
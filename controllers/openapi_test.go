@@ -0,0 +1,149 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"we-credit/controllers"
+	"we-credit/logging"
+	"we-credit/openapi"
+	"we-credit/response"
+	"we-credit/routes"
+)
+
+// syncBuffer collects the log lines written by concurrent handlers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestOpenAPIDocument serves every operation of the OpenAPI document through the
+// real router with response validation on, so that a handler answering a body or
+// a code the document does not describe fails the test. Every case is run with
+// validation off and enforced, and must answer the same code both ways.
+func TestOpenAPIDocument(t *testing.T) {
+	spec, err := openapi.Spec(routes.UserPrefixes()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, validation := range []string{"off", "enforce"} {
+		t.Run(validation, func(t *testing.T) {
+			logs := &syncBuffer{}
+			logging.Setup(logging.Options{Output: logs, Level: slog.LevelError})
+			defer logging.Setup(logging.Options{Output: io.Discard, Level: slog.LevelError})
+
+			cfg := testConfig()
+			cfg.OpenAPI.Validation = validation
+			cfg.OpenAPI.ValidateResponses = true
+			validate, err := openapi.Middleware(spec, cfg.OpenAPI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			memory, repos := memoryRepositories()
+			router := newRouter(cfg, repos, &fakePhones{}, routes.Middlewares{Validate: validate})
+			if err := openapi.CheckRoutes(spec, router.Routes()); err != nil {
+				t.Fatal(err)
+			}
+
+			served := map[string]bool{}
+			for _, prefix := range routes.UserPrefixes() {
+				send := func(method, path string, body any) int {
+					served[method+" "+prefix+path] = true
+					return do(router, method, prefix+path, body).Code
+				}
+				expect := func(method, path string, body any, want *response.Error) {
+					t.Helper()
+					served[method+" "+prefix+path] = true
+					expectError(t, do(router, method, prefix+path, body), want)
+				}
+
+				recorder := do(router, http.MethodPost, prefix+"/authenticate", map[string]string{"phone_number": "4155550100"})
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+				}
+				userID := decode[controllers.RegistrationResponse](t, recorder).UserID
+				otp, err := memory.GetValidVerificationCode(context.Background(), userID)
+				if err != nil {
+					t.Fatalf("GetValidVerificationCode: %v", err)
+				}
+				wrong := "0000"
+				if otp == wrong {
+					wrong = "1111"
+				}
+				profile := "/profile?userID=" + strconv.FormatInt(userID, 10)
+
+				expect(http.MethodPost, "/authenticate", map[string]string{"phone_number": "415555010"}, response.ErrPhoneInvalid)
+				expect(http.MethodPost, "/authenticate", map[string]string{"phone_number": "415555010x"}, response.ErrPhoneInvalid)
+				expect(http.MethodPost, "/authenticate", map[string]int{"phone_number": 4155550100}, response.ErrInvalidRequest)
+				expect(http.MethodPost, "/otp/send", map[string]string{}, response.ErrPhoneInvalid)
+				expect(http.MethodPost, "/otp/verify", map[string]any{"user_id": userID}, response.ErrOTPRequired)
+				expect(http.MethodPost, "/otp/verify", map[string]any{"code": otp, "user_id": 0}, response.ErrUserIDInvalid)
+				expect(http.MethodPost, "/otp/verify", map[string]any{"code": otp, "user_id": "x"}, response.ErrInvalidRequest)
+				expect(http.MethodPost, "/otp/verify", map[string]any{"code": wrong, "user_id": userID}, response.ErrOTPInvalid)
+				expect(http.MethodPost, "/otp/verify", map[string]any{"code": otp, "user_id": 999}, response.ErrUserNotFound)
+				expect(http.MethodGet, "/profile?userID=abc", nil, response.ErrUserIDInvalid)
+				expect(http.MethodGet, "/profile?userID=0", nil, response.ErrUserIDInvalid)
+				expect(http.MethodGet, "/profile", nil, response.ErrUserIDInvalid)
+				expect(http.MethodGet, "/profile?userID=999", nil, response.ErrUserNotFound)
+
+				for _, call := range []struct {
+					method, path string
+					body         any
+				}{
+					{http.MethodPost, "/otp/verify", map[string]any{"code": otp, "user_id": userID}},
+					{http.MethodGet, profile, nil},
+					{http.MethodPost, "/otp/send", map[string]string{"phone_number": "4155550100"}},
+				} {
+					if status := send(call.method, call.path, call.body); status != http.StatusOK {
+						t.Errorf("%s %s%s: status = %d, want 200", call.method, prefix, call.path, status)
+					}
+				}
+			}
+
+			for path, pathItem := range spec.Paths.Map() {
+				for method := range pathItem.Operations() {
+					for _, prefix := range routes.UserPrefixes() {
+						if !servedPath(served, method, prefix+path) {
+							t.Errorf("%s %s%s is not exercised", method, prefix, path)
+						}
+					}
+				}
+			}
+			for _, line := range strings.Split(logs.String(), "\n") {
+				if strings.Contains(line, "response does not match the OpenAPI document") {
+					t.Error(line)
+				}
+			}
+		})
+	}
+}
+
+// servedPath reports whether a request to method and path, ignoring its query, is in served.
+func servedPath(served map[string]bool, method, path string) bool {
+	for key := range served {
+		if before, _, _ := strings.Cut(key, "?"); before == method+" "+path {
+			return true
+		}
+	}
+	return false
+}
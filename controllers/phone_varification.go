@@ -1,171 +1,140 @@
 package controllers
 
 import (
-	"log"
-	"net/http"
-	"os"
-	"regexp"
-	"strconv"
+	"context"
+	"database/sql"
+	"errors"
+	"we-credit/metrics"
 	"we-credit/models"
-	"we-credit/service"
+	"we-credit/repository"
+	"we-credit/response"
 	"we-credit/utility"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SendPhoneNumberVerificationCode generates an OTP, saves it to the database, and sends it via SMS to the specified phone number.
+// verificationMessage returns the SMS text carrying the user's OTP. Users whose
+// phone is already verified are logging in, everyone else is signing up.
+func (ctrl *Controller) verificationMessage(user models.User) string {
+	if user.IsPhoneVerified {
+		return user.OTP + " is the verification code to log in to your Tutree account. Please DO NOT SHARE this code with anyone.\n@" + ctrl.cfg.Server.DomainName + " #" + user.OTP
+	}
+	// content for the otp message
+	return user.OTP + " is the verification code to sign up to your Tutree account. Please DO NOT SHARE this code with anyone.\n@" + ctrl.cfg.Server.DomainName + " #" + user.OTP
+}
+
+// SendPhoneNumberVerificationCode sends the user's OTP via SMS to the user's phone number.
 // Parameters:
-// - phoneNo: The phone number to which the OTP will be sent.
-// - dialingCode: The international dialing code for the phone number.
-// - userIP: Information of user's IP.
-// - location: Location contain user's location information.
+// - ctx: The context of the request.
+// - user: The user holding the phone number, dialing code and OTP to send.
 // Returns:
 // - error: Any error encountered during the process.
-func SendPhoneNumberVerificationCode(user models.User) error {
-
-	var message string
-	if user.IsPhoneVerified {
-		message = user.OTP + " is the verification code to log in to your Tutree account. Please DO NOT SHARE this code with anyone.\n@" + os.Getenv("DOMAIN_NAME") + " #" + user.OTP
-
-	} else {
-		// content for the otp message
-		message = user.OTP + " is the verification code to sign up to your Tutree account. Please DO NOT SHARE this code with anyone.\n@" + os.Getenv("DOMAIN_NAME") + " #" + user.OTP
-	}
+func (ctrl *Controller) SendPhoneNumberVerificationCode(ctx context.Context, user models.User) error {
 
-	log.Println("OTPmessage", message)
+	message := ctrl.verificationMessage(user)
 	// This is the twilio service to send the otp to the given phone number.
 	// function use to send message given phone having message and otp
-	err := service.SendMessage(user.Phone, message, user.DialingCode)
+	err := ctrl.phones.SendMessage(ctx, user.Phone, message, user.DialingCode)
 	if err != nil {
-		log.Println("SendPhoneNumberVerificationCode: sending otp failed: ", err)
+		logger.ErrorContext(ctx, "SendPhoneNumberVerificationCode: sending otp failed", "error", err)
 		return err
 	}
 
 	return nil
 }
 
-// VerifyCode godoc
-// @Summary This controller will verify the given code same as OTP. It will also check if OTP is expired
-// @description This controller will verify the given code same as OTP. It will also check if OTP is expired.
-// @description This api is taking code and userId as postform
-// @Tags PhoneVerification
-// @Accept application/x-www-form-urlencoded
-// @Param code  formData  string true "Code"
-// @Param user-id  formData  string true "user-id"
-// @Param User-Agent header string false "User Agent"
-// @Produce json
-// @Success 200
-// @Router /otp/verify [POST]
-func VerifyCode(c *gin.Context) {
-
-	code := c.PostForm("code")
-	if len(code) == 0 {
-		log.Println("VerifyCode: Verification Code Required, Please enter the OTP (One-Time Password) to proceed.")
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid code.",
-		})
-		return
-
-	}
-	log.Println("CODE ENTER BY user: ", code)
+// VerifyCode handles POST /otp/verify. It expects a VerifyCodeRequest and checks
+// the code against the user's OTP and its expiry. On success the phone is marked
+// verified, a session is created and a VerifyCodeResponse is answered.
+func (ctrl *Controller) VerifyCode(c *gin.Context) {
 
-	userID, err := strconv.Atoi(c.PostForm("user-id"))
+	var req VerifyCodeRequest
+	err := c.ShouldBind(&req)
 	if err != nil {
-		log.Println("Verification Code Error: Failed to convert user ID into a valid number.", err)
-		c.JSON(http.StatusBadGateway, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid user id",
-		})
+		logger.InfoContext(c.Request.Context(), "VerifyCode: invalid request", "error", err)
+		metrics.OTPVerifications.WithLabelValues("failure").Inc()
+		response.Fail(c, bindError(err, map[string]*response.Error{
+			"Code":   response.ErrOTPRequired,
+			"UserID": response.ErrUserIDInvalid,
+		}))
 		return
 	}
+	code, userID := req.Code, int(req.UserID)
 
 	// function use to fetch user details by user id
-	user, err := models.GetUserByID(userID)
+	user, err := ctrl.users.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
-		log.Println("VerifyCode: failed to fetch user data :", err)
-		c.JSON(http.StatusNotFound, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid user details.",
-		})
+		logger.WarnContext(c.Request.Context(), "VerifyCode: failed to fetch user data", "error", err)
+		metrics.OTPVerifications.WithLabelValues("failure").Inc()
+		if errors.Is(err, sql.ErrNoRows) {
+			response.Fail(c, response.ErrUserNotFound)
+			return
+		}
+		response.Fail(c, response.ErrInternal)
 		return
 	}
-	OTP, err := models.GetValidVerificationCode(int64(userID))
+	OTP, err := ctrl.otps.GetValidVerificationCode(c.Request.Context(), int64(userID))
 	if err != nil {
-		log.Println("VerifyCode: Error occurred while fetching OTP or checking if it is expired for user ID:", err)
-		c.JSON(http.StatusBadGateway, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid otp, OTP expired.",
-		})
+		logger.WarnContext(c.Request.Context(), "VerifyCode: error occurred while fetching OTP or checking if it is expired", "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, repository.ErrOTPExpired):
+			metrics.OTPVerifications.WithLabelValues("expired").Inc()
+			response.Fail(c, response.ErrOTPExpired)
+		case errors.Is(err, sql.ErrNoRows):
+			metrics.OTPVerifications.WithLabelValues("failure").Inc()
+			response.Fail(c, response.ErrUserNotFound)
+		default:
+			metrics.OTPVerifications.WithLabelValues("failure").Inc()
+			response.Fail(c, response.ErrInternal)
+		}
 		return
 	}
 	// for local, testing environment this line of code would accept "1234" as valid OTP.
 	if code == OTP {
-		err := models.SetPhoneVerified(int64(userID))
+		err := ctrl.otps.SetPhoneVerified(c.Request.Context(), int64(userID))
 		if err != nil {
-			log.Println("VerifyCode: failed to verify Phone number:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "Failed",
-				"message": "Please enter a valid user ID.",
-			})
+			logger.ErrorContext(c.Request.Context(), "VerifyCode: failed to verify phone number", "error", err)
+			metrics.OTPVerifications.WithLabelValues("failure").Inc()
+			response.Fail(c, response.ErrInternal)
 			return
 		}
 
-		token := CreateUserAuth(c, user)
+		metrics.OTPVerifications.WithLabelValues("success").Inc()
+		token := ctrl.CreateUserAuth(c, user)
 
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "success",
-			"message": "Sucessfully verified phone number.",
-			"token":   token,
-			"user_id": user.ID,
+		response.OK(c, VerifyCodeResponse{
+			Status:  response.StatusSuccess,
+			Message: "Sucessfully verified phone number.",
+			Token:   token,
+			UserID:  user.ID,
 		})
 		return
 	} else {
-		log.Println("Verification Failed: The OTP entered is incorrect. Please retry with the correct OTP.")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid otp",
-		})
+		logger.InfoContext(c.Request.Context(), "VerifyCode: the OTP entered is incorrect", "user_id", userID)
+		metrics.OTPVerifications.WithLabelValues("failure").Inc()
+		response.Fail(c, response.ErrOTPInvalid)
 		return
 
 	}
 }
 
-// ResendVerificationCode godoc
-// @Summary This controller will resend the given code same as OTP.
-// @description This controller will resend the OTP.
-// @description This api is taking phone number as postform and user ip from header.
-// @Tags PhoneVerification
-// @Accept application/x-www-form-urlencoded
-// @Param phone-number  formData  string true "Phone Number"
-// @Produce json
-// @Success 200
-// @Router /otp/send [POST]
-func ResendVerificationCode(c *gin.Context) {
+// ResendVerificationCode handles POST /otp/send. It expects a ResendCodeRequest,
+// generates a new OTP and sends it by SMS, answering a ResendCodeResponse.
+func (ctrl *Controller) ResendVerificationCode(c *gin.Context) {
 
-	userIP := utility.GetClientIP(c)
-	phoneNumber := c.PostForm("phone-number")
-	if len(phoneNumber) == 0 {
-		log.Println("ResendVerificationCode: failed, phone nnumber can not be empty.")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid phone no.",
-		})
-		return
-	}
-	match, err := regexp.MatchString("^[0-9]{10}$", phoneNumber)
-	if !match || err != nil {
-		log.Println("ResendVerificationCode: Failed, invalid phone number with error: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid phone no.",
-		})
+	userIP := utility.GetClientIP(c, ctrl.cfg.Server)
+	var req ResendCodeRequest
+	err := c.ShouldBind(&req)
+	if err != nil {
+		logger.InfoContext(c.Request.Context(), "ResendVerificationCode: invalid phone number", "error", err)
+		response.Fail(c, bindError(err, map[string]*response.Error{"PhoneNumber": response.ErrPhoneInvalid}))
 		return
 	}
-	location := service.GetLocationFromIP(userIP)
-	details, err := models.GetDetailsOfSupportedCountryByCode(location.CountryCode)
+	phoneNumber := req.PhoneNumber
+	location := ctrl.locations.Lookup(c.Request.Context(), userIP, utility.PreferredLanguages(c)...)
+	details, err := ctrl.countries.GetDetailsOfSupportedCountryByCode(c.Request.Context(), location.CountryCode)
 	if err != nil {
-		log.Println("ResendVerificationCode: GetDetailsOfSupportedCountryByCode failed to get location iformation with error: ", err)
+		logger.WarnContext(c.Request.Context(), "ResendVerificationCode: GetDetailsOfSupportedCountryByCode failed to get location information", "error", err)
 	}
 	otp := utility.GenerateOTP()
 
@@ -176,26 +145,21 @@ func ResendVerificationCode(c *gin.Context) {
 		Location:    location,
 		OTP:         otp,
 	}
-	_, err = models.SaveOTP(user)
+	_, err = ctrl.otps.SaveOTP(c.Request.Context(), user)
 	if err != nil {
-		log.Println("ResendVerificationCode Failed: Unable to send verification code. Please try again later", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "Failed",
-			"message": "Failed to save otp",
-		})
+		logger.ErrorContext(c.Request.Context(), "ResendVerificationCode: unable to save verification code", "error", err)
+		response.Fail(c, response.ErrInternal)
 		return
 	}
 	// func to send the verification code to the user's phone number
-	err = SendPhoneNumberVerificationCode(user)
+	err = ctrl.SendPhoneNumberVerificationCode(c.Request.Context(), user)
 	if err != nil {
-		log.Println("ResendVerificationCode Failed: Unable to send verification code. Please try again later", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "Failed",
-			"message": "Failed to send otp",
-		})
+		logger.ErrorContext(c.Request.Context(), "ResendVerificationCode: unable to send verification code", "error", err)
+		response.Fail(c, response.ErrSMSFailed)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"mesage": "One time message has been sent to you phone number",
+	response.OK(c, ResendCodeResponse{
+		Status:  response.StatusSuccess,
+		Message: "One time message has been sent to you phone number.",
 	})
 }
@@ -0,0 +1,92 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"we-credit/controllers"
+	"we-credit/response"
+	"we-credit/routes"
+)
+
+func TestResendVerificationCode(t *testing.T) {
+	memory, repos := memoryRepositories()
+	phones := &fakePhones{}
+	router := newRouter(testConfig(), repos, phones, routes.Middlewares{})
+
+	recorder := do(router, http.MethodPost, "/api/v1/user/otp/send", map[string]string{"phone_number": "4155550100"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	if body := decode[controllers.ResendCodeResponse](t, recorder); body.Status != response.StatusSuccess {
+		t.Errorf("body = %+v", body)
+	}
+
+	sent := phones.messages()
+	if len(sent) != 1 || sent[0].phone != "4155550100" {
+		t.Fatalf("sent = %+v, want one SMS to 4155550100", sent)
+	}
+	otp, err := memory.GetValidVerificationCode(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetValidVerificationCode: %v", err)
+	}
+	if !strings.HasPrefix(sent[0].message, otp+" ") || !strings.HasSuffix(sent[0].message, "@example.com #"+otp) {
+		t.Errorf("message = %q, want the saved OTP %s", sent[0].message, otp)
+	}
+
+	expectError(t, do(router, http.MethodPost, "/api/v1/user/otp/send", map[string]string{"phone_number": "12"}), response.ErrPhoneInvalid)
+}
+
+func TestVerifyCode(t *testing.T) {
+	memory, repos := memoryRepositories()
+	phones := &fakePhones{}
+	router := newRouter(testConfig(), repos, phones, routes.Middlewares{})
+	recorder := do(router, http.MethodPost, "/api/v1/user/authenticate", map[string]string{"phone_number": "4155550100"})
+	userID := decode[controllers.RegistrationResponse](t, recorder).UserID
+	otp, err := memory.GetValidVerificationCode(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetValidVerificationCode: %v", err)
+	}
+
+	wrong := "0000"
+	if otp == wrong {
+		wrong = "1111"
+	}
+	expectError(t, do(router, http.MethodPost, "/api/v1/user/otp/verify", map[string]any{"code": wrong, "user_id": userID}), response.ErrOTPInvalid)
+	expectError(t, do(router, http.MethodPost, "/api/v1/user/otp/verify", map[string]any{"code": otp, "user_id": 999}), response.ErrUserNotFound)
+	expectError(t, do(router, http.MethodPost, "/api/v1/user/otp/verify", map[string]any{"user_id": userID}), response.ErrOTPRequired)
+	if len(memory.Sessions()) != 0 {
+		t.Fatalf("a session was created by a failed verification")
+	}
+
+	recorder = do(router, http.MethodPost, "/api/v1/user/otp/verify", map[string]any{"code": otp, "user_id": userID})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	verified := decode[controllers.VerifyCodeResponse](t, recorder)
+	if verified.Status != response.StatusSuccess || verified.UserID != userID || verified.Token == "" {
+		t.Errorf("body = %+v", verified)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range recorder.Result().Cookies() {
+		if c.Name == "token" {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != verified.Token || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie = %+v, want a secure HttpOnly SameSite=Lax token cookie", cookie)
+	}
+
+	sessions := memory.Sessions()
+	if len(sessions) != 1 || sessions[0].UserID != userID || sessions[0].Token != verified.Token || !reflect.DeepEqual(sessions[0].Location, sydney) {
+		t.Errorf("sessions = %+v, want one session in Sydney", sessions)
+	}
+	profile, err := memory.GetUserProfile(context.Background(), int(userID))
+	if err != nil || !profile.IsPhoneVerified {
+		t.Errorf("profile = %+v, %v, want a verified phone", profile, err)
+	}
+}
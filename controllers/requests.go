@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+	"we-credit/response"
+	"we-credit/service"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// The request and response types below are also the source of the OpenAPI
+// document, see package openapi, so they must describe the handlers exactly.
+//
+// The request types are bound with gin's ShouldBind, which reads JSON
+// bodies through the json tags and form posts through the form tags, and then
+// validates them against the binding tags.
+
+// RegistrationRequest is the body of POST /authenticate.
+type RegistrationRequest struct {
+	// PhoneNumber is the 10 digit national number, without the dialing code.
+	PhoneNumber string `json:"phone_number" form:"phone-number" binding:"required,number,len=10"`
+}
+
+// VerifyCodeRequest is the body of POST /otp/verify.
+type VerifyCodeRequest struct {
+	Code   string `json:"code" form:"code" binding:"required,number,max=10"`
+	UserID int64  `json:"user_id" form:"user-id" binding:"required,gt=0"`
+}
+
+// ResendCodeRequest is the body of POST /otp/send.
+type ResendCodeRequest struct {
+	// PhoneNumber is the 10 digit national number, without the dialing code.
+	PhoneNumber string `json:"phone_number" form:"phone-number" binding:"required,number,len=10"`
+}
+
+// ProfileRequest is the query of GET /profile.
+type ProfileRequest struct {
+	UserID int `form:"userID" binding:"required,gt=0"`
+}
+
+// bindError maps a binding error to the API error of the field that failed
+// validation, using fields to look it up. Bodies that cannot be parsed at all,
+// e.g. malformed JSON or a user id that is not a number, are ErrInvalidRequest.
+func bindError(err error, fields map[string]*response.Error) *response.Error {
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) && len(invalid) > 0 {
+		if apiErr, found := fields[invalid[0].Field()]; found {
+			return apiErr.Wrap(err)
+		}
+	}
+	return response.ErrInvalidRequest.Wrap(err)
+}
+
+// RegistrationResponse is the body of a successful POST /authenticate.
+type RegistrationResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	UserID  int64  `json:"user_id"`
+	// PhoneVerified is true when the user is logging in rather than signing up.
+	PhoneVerified bool `json:"phone_verified"`
+}
+
+// VerifyCodeResponse is the body of a successful POST /otp/verify.
+type VerifyCodeResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Token is the session JWT, also set as the token cookie.
+	Token  string `json:"token"`
+	UserID int64  `json:"user_id"`
+}
+
+// ResendCodeResponse is the body of a successful POST /otp/send.
+type ResendCodeResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// ProfileResponse is the body of a successful GET /profile.
+type ProfileResponse struct {
+	ID              int64            `json:"id"`
+	Phone           string           `json:"phone"`
+	DialingCode     string           `json:"dialing_code,omitempty"`
+	Location        service.Location `json:"location"`
+	IsPhoneVerified bool             `json:"IsPhoneVerified"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
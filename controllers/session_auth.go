@@ -1,11 +1,10 @@
 package controllers
 
 import (
-	"log"
-	"os"
 	"time"
+	"we-credit/clientip"
+	"we-credit/metrics"
 	"we-credit/models"
-	"we-credit/service"
 	"we-credit/utility"
 
 	"github.com/dgrijalva/jwt-go"
@@ -19,40 +18,57 @@ import (
 // - phone: The phone number of the user for whom the session is being created.
 // Returns:
 // - string: The generated JWT token string.
-func CreateUserAuth(c *gin.Context, user models.User) string {
+func (ctrl *Controller) CreateUserAuth(c *gin.Context, user models.User) string {
 
 	userAgent := c.GetHeader("User-Agent")
 	ua := user_agent.New(userAgent)
 	device := ua.OS()
 	browser, _ := ua.Browser()
-	userIP := utility.GetClientIP(c)
-	authLocaiton := service.GetLocationFromIP(userIP)
+	userIP := utility.GetClientIP(c, ctrl.cfg.Server)
+	authLocaiton := ctrl.locations.Lookup(c.Request.Context(), userIP, utility.PreferredLanguages(c)...)
 
 	var token string
 	// Define the session duration as 5 years in seconds
 	// 365 days/year * 24 hours/day * 60 minutes/hour * 60 seconds/minute * 5 years
 	maxAge := 365 * 24 * 60 * 60 * 5
-	// Get the domain name from the environment variables for the cookie
-	domain := os.Getenv("HOST")
 	// Generate a JWT token using the provided phone number
-	token, _ = createJWT(user.Phone)
-	// Set the JWT token as a cookie in the HTTP response
-	// Parameters:
-	// - "tokenString": The name of the cookie
-	// - SessionID: The value of the cookie (the JWT token)
-	// - maxAge: The maximum age of the cookie in seconds (5 years)
-	// - "/": The path where the cookie is valid (root path)
-	// - domain: The domain for which the cookie is valid
-	// - false: Whether the cookie should be sent only over HTTPS (false for HTTP and HTTPS)
-	// - false: Whether the cookie should be accessible only through HTTP requests (true for HTTP-only cookies)
+	token, _ = createJWT(user.Phone, ctrl.cfg.Auth.JWTSecretKey)
 	tokenValidity := getTimeForCookies()
-	location := authLocaiton.City + ", " + authLocaiton.State + ", " + authLocaiton.Country
-	models.CreateNewSession(user.ID, tokenValidity, token, browser, userIP, location, device)
+	err := ctrl.sessions.CreateNewSession(c.Request.Context(), models.Session{
+		UserID:     user.ID,
+		Token:      token,
+		ValidUntil: tokenValidity,
+		Browser:    browser,
+		Device:     device,
+		IP:         userIP,
+		IPChain:    clientip.Get(c).Chain,
+		Location:   authLocaiton,
+	})
+	if err == nil {
+		metrics.SessionsCreated.Inc()
+	}
 
-	c.SetCookie("token", token, maxAge, "/", domain, false, false)
+	ctrl.setAuthCookie(c, token, maxAge)
 	return token
 }
 
+// setAuthCookie sets the session cookie with the attributes of the auth configuration.
+// Parameters:
+// - c: The Gin context object for handling the HTTP request and response.
+// - token: The value of the cookie (the JWT token).
+// - maxAge: The maximum age of the cookie in seconds.
+func (ctrl *Controller) setAuthCookie(c *gin.Context, token string, maxAge int) {
+	auth := ctrl.cfg.Auth
+	// the cookie is valid for the whole domain in HOST, except with the __Host- prefix
+	// which browsers only accept when it is bound to the exact host
+	domain := ctrl.cfg.Server.Host
+	if auth.CookieHostPrefix {
+		domain = ""
+	}
+	c.SetSameSite(auth.SameSite())
+	c.SetCookie(auth.Cookie(), token, maxAge, "/", domain, auth.CookieSecure, auth.CookieHTTPOnly)
+}
+
 // GetTimeForCookies returns the expiration time for cookies, set to 5 years from the current time.
 // Returns:
 // - time.Time: The expiration time for cookies, which is 5 years from now.
@@ -66,7 +82,7 @@ func getTimeForCookies() time.Time {
 // Returns:
 // - string: The generated JWT token as a string.
 // - error: Any error encountered during the token generation.
-func createJWT(phone string) (string, error) {
+func createJWT(phone, secretKey string) (string, error) {
 	expirationTime := getTimeForCookies()
 
 	claims := &models.JWTAuthClaims{
@@ -77,11 +93,11 @@ func createJWT(phone string) (string, error) {
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+	var jwtKey = []byte(secretKey)
 	tokenString, err := token.SignedString(jwtKey)
 
 	if err != nil {
-		log.Println("[ERROR] CreateJWT: failed with an error: ", err)
+		logger.Error("CreateJWT: failed to sign token", "error", err)
 	}
 
 	return tokenString, err
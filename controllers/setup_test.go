@@ -0,0 +1,175 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"we-credit/config"
+	"we-credit/controllers"
+	"we-credit/health"
+	"we-credit/logging"
+	"we-credit/models"
+	"we-credit/repository"
+	"we-credit/response"
+	"we-credit/routes"
+	"we-credit/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	// handlers log every failure they answer, which would drown the test output
+	logging.Setup(logging.Options{Output: io.Discard, Level: slog.LevelError})
+	os.Exit(m.Run())
+}
+
+// sentSMS is a message handed to fakePhones.SendMessage.
+type sentSMS struct {
+	phone   string
+	message string
+}
+
+// fakePhones implements controllers.PhoneService without calling Twilio.
+// Every number is deliverable and not VoIP unless told otherwise.
+type fakePhones struct {
+	mu            sync.Mutex
+	undeliverable bool
+	voip          bool
+	// lookupErr fails the deliverability lookups when set.
+	lookupErr error
+	sent      []sentSMS
+}
+
+func (p *fakePhones) IsPhNumberDeliverable(_ context.Context, _, _ string) (bool, error) {
+	if p.lookupErr != nil {
+		return false, p.lookupErr
+	}
+	return !p.undeliverable, nil
+}
+
+func (p *fakePhones) IsPhoneNumberVoip(_ context.Context, _, _ string) (bool, error) {
+	return p.voip, nil
+}
+
+func (p *fakePhones) SendMessage(_ context.Context, phone string, message string, _ string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, sentSMS{phone: phone, message: message})
+	return nil
+}
+
+// messages returns every SMS sent so far.
+func (p *fakePhones) messages() []sentSMS {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]sentSMS(nil), p.sent...)
+}
+
+// fakeLocations implements controllers.LocationService, locating every IP at location.
+type fakeLocations struct {
+	location service.Location
+}
+
+func (l fakeLocations) Lookup(_ context.Context, _ string, _ ...string) service.Location {
+	return l.location
+}
+
+// sydney is where fakeLocations puts clients by default.
+var sydney = service.Location{
+	CountryCode: "AU",
+	Country:     "Australia",
+	State:       "New South Wales",
+	StateCode:   "NSW",
+	City:        "Sydney",
+	TimeZone:    "Australia/Sydney",
+}
+
+// testConfig returns the configuration the handlers are tested with. VoIP numbers
+// are rejected so that the VoIP lookup is part of every registration.
+func testConfig() config.Config {
+	return config.Config{
+		Server: config.ServerConfig{
+			Port:             8181,
+			GinMode:          gin.TestMode,
+			DomainName:       "example.com",
+			ReadinessTimeout: time.Second,
+		},
+		Auth: config.AuthConfig{
+			JWTSecretKey:   "test-secret",
+			CookieName:     "token",
+			CookieSecure:   true,
+			CookieHTTPOnly: true,
+			CookieSameSite: "lax",
+		},
+		OpenAPI: config.OpenAPIConfig{Validation: "off"},
+	}
+}
+
+// memoryRepositories returns an in-memory repository supporting Australia and the
+// United States, and the controller repositories backed by it.
+func memoryRepositories() (*repository.Memory, controllers.Repositories) {
+	memory := repository.NewMemory()
+	memory.AddCountry(models.CountryDetail{CountryID: 1, CountryName: "United States", CountryCode: "US", CountryPhoneCode: "+1"})
+	memory.AddCountry(models.CountryDetail{CountryID: 2, CountryName: "Australia", CountryCode: "AU", CountryPhoneCode: "+61"})
+	return memory, controllers.Repositories{
+		Users:         memory,
+		OTPs:          memory,
+		Sessions:      memory,
+		Countries:     memory,
+		Registrations: memory,
+	}
+}
+
+// newRouter returns the public router serving a controller built on repos and phones.
+func newRouter(cfg config.Config, repos controllers.Repositories, phones controllers.PhoneService, mw routes.Middlewares) *gin.Engine {
+	ctrl := controllers.NewController(cfg, repos, phones, fakeLocations{location: sydney})
+	return routes.SetupRouter(cfg, ctrl, health.NewChecker(cfg.Server.ReadinessTimeout), mw)
+}
+
+// do sends a request to router, with body encoded as JSON unless it is nil, and returns the recorded response.
+func do(router http.Handler, method, target string, body any) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// decode decodes the JSON body of recorder into a T.
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var body T
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", recorder.Body, err)
+	}
+	return body
+}
+
+// expectError checks that recorder holds the error envelope of want.
+func expectError(t *testing.T, recorder *httptest.ResponseRecorder, want *response.Error) {
+	t.Helper()
+	if recorder.Code != want.Status {
+		t.Errorf("status = %d, want %d: %s", recorder.Code, want.Status, recorder.Body)
+	}
+	body := decode[response.ErrorBody](t, recorder)
+	if body.Code != want.Code || body.Status != response.StatusFailed {
+		t.Errorf("body = %+v, want code %s", body, want.Code)
+	}
+}
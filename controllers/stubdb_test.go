@@ -0,0 +1,48 @@
+package controllers_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"we-credit/repository/stubdb"
+)
+
+// registrationAnswer answers the queries of a registration: the supported country
+// lookups and the user upsert, which creates a new user every time.
+func registrationAnswer() func(stubdb.Query) (stubdb.Rows, error) {
+	var nextUserID atomic.Int64
+	return func(query stubdb.Query) (stubdb.Rows, error) {
+		switch {
+		case strings.Contains(query.SQL, "SELECT EXISTS"):
+			return stubdb.Rows{Columns: []string{"exists"}, Values: [][]driver.Value{{true}}}, nil
+		case strings.Contains(query.SQL, "phonecode"):
+			return stubdb.Rows{
+				Columns: []string{"id", "name", "iso2", "phonecode"},
+				Values:  [][]driver.Value{{int64(2), "Australia", "AU", "+61"}},
+			}, nil
+		case strings.Contains(query.SQL, "INSERT INTO public.user"):
+			return stubdb.Rows{
+				Columns: []string{"id", "phone_verified", "action"},
+				Values:  [][]driver.Value{{nextUserID.Add(1), false, "insert"}},
+			}, nil
+		case strings.Contains(query.SQL, "INSERT INTO"):
+			return stubdb.Rows{}, nil
+		}
+		return stubdb.Rows{}, errors.New("registrationAnswer: unexpected query " + query.SQL)
+	}
+}
+
+// openStubDB returns a pool of stub connections answering registrations. With
+// maxIdle 0 every query opens a new connection and closes it afterwards, as when
+// each query opened its own pool.
+func openStubDB(connectLatency time.Duration, maxIdle int) (*sql.DB, *stubdb.Connector) {
+	connector := &stubdb.Connector{Answer: registrationAnswer(), ConnectLatency: connectLatency}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(maxIdle)
+	return db, connector
+}
@@ -1,69 +1,49 @@
 package controllers
 
 import (
-	"log"
-	"net/http"
-	"regexp"
-	"strconv"
-	"sync"
+	"we-credit/metrics"
 	"we-credit/models"
-	"we-credit/service"
+	"we-credit/response"
 	"we-credit/utility"
 
 	"github.com/gin-gonic/gin"
 )
 
-// UserRegistration godoc
-// @Summary This controller will handles the registration process for user.
-// @description The UserRegistration function handles the process of signing up
-// @description user on a website. It expects the user to submit their phone number through a form.
-// @Tags Registration
-// @Accept application/x-www-form-urlencoded
-// @Param phone-number  formData  string true "Phone"
-// @Produce json
-// @Success 200
-// @Router /authenticate [post]
-func UserRegistration(c *gin.Context) {
-	user := RegisterUser(c)
+// UserRegistration handles POST /authenticate, the sign up and log in of a user by
+// phone number. It expects a RegistrationRequest and answers a RegistrationResponse
+// once the verification code is queued for delivery by SMS.
+func (ctrl *Controller) UserRegistration(c *gin.Context) {
+	user := ctrl.RegisterUser(c)
 	// All errors are handled in the 'RegisterUser' function.
 	// If any error occurs, 'RegisterUser' returns an error in c.JSON and an empty 'User' struct.
 	// We check if the struct is empty then return from the function to prevent sending both an error and a success response.
 	if user.ID == 0 {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success",
-		"message":        "One time message has been sent to you phone number.",
-		"user_id":        user.ID,
-		"phone_verified": user.IsPhoneVerified,
+	response.OK(c, RegistrationResponse{
+		Status:        response.StatusSuccess,
+		Message:       "One time message has been sent to you phone number.",
+		UserID:        user.ID,
+		PhoneVerified: user.IsPhoneVerified,
 	})
 }
-func RegisterUser(c *gin.Context) models.User {
+func (ctrl *Controller) RegisterUser(c *gin.Context) models.User {
 
-	userIP := utility.GetClientIP(c)
-	phoneNumber := c.PostForm("phone-number")
-	// Check if the phone number is empty.
-	if len(phoneNumber) == 0 {
-		log.Println("Registration Failed: Phone number not found. Please enter a valid phone number.")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid number",
-		})
-		return models.User{}
-	}
-	// Use a regular expression to validate the phone number format (exactly 10 digits).
-	match, err := regexp.MatchString("^[0-9]{10}$", phoneNumber)
-	if !match || err != nil {
-		log.Println("RegisterUser: Failed, invalid phone number with error: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid number",
-		})
+	userIP := utility.GetClientIP(c, ctrl.cfg.Server)
+	// The phone number must be exactly 10 digits, see RegistrationRequest.
+	var req RegistrationRequest
+	err := c.ShouldBind(&req)
+	if err != nil {
+		logger.InfoContext(c.Request.Context(), "RegisterUser: invalid phone number", "error", err)
+		metrics.Registrations.WithLabelValues("invalid_phone").Inc()
+		response.Fail(c, bindError(err, map[string]*response.Error{"PhoneNumber": response.ErrPhoneInvalid}))
 		return models.User{}
 	}
-	location := service.GetLocationFromIP(userIP)
-	details, err := models.GetDetailsOfSupportedCountryByCode(location.CountryCode)
+	phoneNumber := req.PhoneNumber
+	location := ctrl.locations.Lookup(c.Request.Context(), userIP, utility.PreferredLanguages(c)...)
+	details, err := ctrl.countries.GetDetailsOfSupportedCountryByCode(c.Request.Context(), location.CountryCode)
 	if err != nil {
-		log.Println("RegisterUser: GetDetailsOfSupportedCountryByCode failed to get location information with error: ", err)
+		logger.WarnContext(c.Request.Context(), "RegisterUser: GetDetailsOfSupportedCountryByCode failed to get location information", "error", err)
 	}
 	otp := utility.GenerateOTP()
 	user := models.User{
@@ -74,103 +54,83 @@ func RegisterUser(c *gin.Context) models.User {
 		OTP:         otp,
 	}
 	// This func will check is tht given phone number deliverable or not, if not deliverable will return an error message
-	isDeliverable, err := service.IsPhNumberDeliverable(phoneNumber, details.CountryCode)
+	isDeliverable, err := ctrl.phones.IsPhNumberDeliverable(c.Request.Context(), phoneNumber, details.CountryCode)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "RegisterUser: failed while checking phone number is deliverable", "error", err)
+		metrics.Registrations.WithLabelValues("failed").Inc()
+		response.Fail(c, response.ErrProviderUnavailable)
+		return models.User{}
+	}
 	if !isDeliverable {
-		log.Println("RegisterUser: failed phone number lookup with flag :", isDeliverable)
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "Failed",
-			"message": "Please enter a valid number",
-		})
+		logger.InfoContext(c.Request.Context(), "RegisterUser: phone number is not deliverable")
+		metrics.Registrations.WithLabelValues("undeliverable").Inc()
+		response.Fail(c, response.ErrPhoneUndeliverable)
 		return models.User{}
 	}
 	// This func will check is tht given phone number voip or not, if not deliverable will return an error message
-	isVoipNumberAllowed := utility.AllowVoipNumbers()
-	if !isVoipNumberAllowed {
-		isVoip, err := service.IsPhoneNumberVoip(phoneNumber, details.CountryCode)
+	if !ctrl.cfg.Twilio.AllowVoipNumbers {
+		isVoip, err := ctrl.phones.IsPhoneNumberVoip(c.Request.Context(), phoneNumber, details.CountryCode)
 		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "Failed",
-				"message": "Please enter a valid number",
-				"error":   err,
-			})
+			logger.ErrorContext(c.Request.Context(), "RegisterUser: failed while checking phone number is voip", "error", err)
+			metrics.Registrations.WithLabelValues("failed").Inc()
+			response.Fail(c, response.ErrProviderUnavailable)
+			return models.User{}
 		}
 		if isVoip {
-			log.Println("RegisterUser: failed while checking phone number is voip :", isVoip)
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "Failed",
-				"message": "Please enter a valid number",
-			})
+			logger.InfoContext(c.Request.Context(), "RegisterUser: rejected voip phone number")
+			metrics.Registrations.WithLabelValues("voip_rejected").Inc()
+			response.Fail(c, response.ErrPhoneVoip)
 			return models.User{}
 		}
 	}
 
-	// func to send the verification code to the user's phone number
-	err = SendPhoneNumberVerificationCode(user)
+	// Save the user, its OTP challenge and the verification SMS in one transaction.
+	// The SMS is delivered by the outbox dispatcher once the challenge is durable.
+	action, err := ctrl.registrations.RegisterUser(c.Request.Context(), &user, ctrl.verificationMessage)
 	if err != nil {
-		log.Println("Registration Failed: Unable to send verification code. Please try again later", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Failed to send otp.",
-		})
+		logger.ErrorContext(c.Request.Context(), "RegisterUser: unable to save verification code", "error", err)
+		metrics.Registrations.WithLabelValues("failed").Inc()
+		response.Fail(c, response.ErrInternal)
 		return models.User{}
 	}
-
-	_, _ = models.SaveNewUser(&user)
+	if action == "insert" {
+		metrics.Registrations.WithLabelValues("created").Inc()
+	} else {
+		metrics.Registrations.WithLabelValues("existing").Inc()
+	}
 	return user
 }
 
-// GetStudentProfile godoc
-// @Summary This controller will handles to fetch profile of students.
-// @description This function retrieves the student's profile based on the provided Authorization token and
-// @description fetches the student's demo session details. It responds with a JSON object containing the student's information
-// @description and demo session details.
-// @Tags Student
-// @Accept application/x-www-form-urlencoded
-// @Param userID query  number true "User ID"
-// @Produce json
-// @Success 200
-// @Router /profile [get]
-func GetUserProfile(c *gin.Context) {
-	// Fetch the authorization token from the request header.
-	userIDStr := c.Query("userID")
-	if len(userIDStr) == 0 {
-		log.Println("GetUserProfile: Failed to fetch user's id.")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Failed to fetch user id from query params.",
-		})
+// GetUserProfile handles GET /profile. It expects a ProfileRequest and answers
+// the ProfileResponse of the user, or USER_NOT_FOUND.
+func (ctrl *Controller) GetUserProfile(c *gin.Context) {
+	var req ProfileRequest
+	err := c.ShouldBindQuery(&req)
+	if err != nil {
+		logger.InfoContext(c.Request.Context(), "GetUserProfile: invalid user id", "error", err)
+		response.Fail(c, response.ErrUserIDInvalid.Wrap(err))
 		return
 	}
-	userID, err := strconv.Atoi(userIDStr)
+	userID := req.UserID
+	// Fetch the student's profile details using user ID.
+	userProfile, err := ctrl.users.GetUserProfile(c.Request.Context(), userID)
 	if err != nil {
-		log.Println("GetUserProfile: Failed to parse user's id into integer.")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "Failed",
-			"message": "Failed to parse user id into integer.",
-		})
+		logger.ErrorContext(c.Request.Context(), "GetUserProfile: failed to fetch user's details by using user ID", "error", err)
+		response.Fail(c, response.ErrInternal)
+		return
+	}
+	if userProfile.ID == 0 {
+		response.Fail(c, response.ErrUserNotFound)
 		return
 	}
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	var userProfile models.User
-	var fetchProfileErr error
-
-	go func() {
-		defer wg.Done()
-		// Fetch the student's profile details using user ID.
-		userProfile, fetchProfileErr = models.GetUserProfile(userID)
-		if fetchProfileErr != nil {
-			log.Println("[ERROR] GetUserProfile: Failed to fetch user's details by using user ID with error: ", fetchProfileErr)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "Failed",
-				"message": "Failed to fetch user details from database.",
-			})
-			return
-		}
-	}()
-	wg.Wait()
 	// Send the JSON response with the student profile and demo session details.
-	c.JSON(http.StatusOK, userProfile)
+	response.OK(c, ProfileResponse{
+		ID:              userProfile.ID,
+		Phone:           userProfile.Phone,
+		DialingCode:     userProfile.DialingCode,
+		Location:        userProfile.Location,
+		IsPhoneVerified: userProfile.IsPhoneVerified,
+		CreatedAt:       userProfile.CreatedAt,
+	})
 
 }
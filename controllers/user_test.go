@@ -0,0 +1,121 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"we-credit/controllers"
+	"we-credit/response"
+	"we-credit/routes"
+)
+
+func TestUserRegistration(t *testing.T) {
+	memory, repos := memoryRepositories()
+	phones := &fakePhones{}
+	router := newRouter(testConfig(), repos, phones, routes.Middlewares{})
+
+	recorder := do(router, http.MethodPost, "/api/v1/user/authenticate", map[string]string{"phone_number": "4155550100"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	registered := decode[controllers.RegistrationResponse](t, recorder)
+	if registered.Status != response.StatusSuccess || registered.UserID == 0 || registered.PhoneVerified {
+		t.Fatalf("body = %+v, want a new unverified user", registered)
+	}
+
+	user, err := memory.GetUserByID(context.Background(), int(registered.UserID))
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Phone != "4155550100" || user.DialingCode != "+61" || !reflect.DeepEqual(user.Location, sydney) {
+		t.Errorf("saved user = %+v, want the phone number located in Sydney with dialing code +61", user)
+	}
+
+	// the SMS is queued for the outbox dispatcher, not sent by the handler
+	if sent := phones.messages(); len(sent) != 0 {
+		t.Errorf("sent %d SMS, want none before the outbox is dispatched", len(sent))
+	}
+	queued, err := memory.ClaimPendingSMS(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimPendingSMS: %v", err)
+	}
+	if len(queued) != 1 || queued[0].UserID != registered.UserID || !strings.HasPrefix(queued[0].Message, user.OTP+" ") {
+		t.Errorf("queued = %+v, want one SMS carrying the OTP of user %d", queued, registered.UserID)
+	}
+
+	// registering the same phone number again signs in the same user
+	recorder = do(router, http.MethodPost, "/user/authenticate", map[string]string{"phone_number": "4155550100"})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	if again := decode[controllers.RegistrationResponse](t, recorder); again.UserID != registered.UserID {
+		t.Errorf("user id = %d, want %d", again.UserID, registered.UserID)
+	}
+}
+
+func TestUserRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		phone  string
+		phones *fakePhones
+		want   *response.Error
+	}{
+		{"too short", "415555", &fakePhones{}, response.ErrPhoneInvalid},
+		{"not a number", "415555010x", &fakePhones{}, response.ErrPhoneInvalid},
+		{"undeliverable", "4155550100", &fakePhones{undeliverable: true}, response.ErrPhoneUndeliverable},
+		{"voip", "4155550100", &fakePhones{voip: true}, response.ErrPhoneVoip},
+		{"lookup failed", "4155550100", &fakePhones{lookupErr: errors.New("Status: 503 - ApiError 20503")}, response.ErrProviderUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory, repos := memoryRepositories()
+			router := newRouter(testConfig(), repos, test.phones, routes.Middlewares{})
+
+			recorder := do(router, http.MethodPost, "/api/v1/user/authenticate", map[string]string{"phone_number": test.phone})
+			expectError(t, recorder, test.want)
+			if _, err := memory.GetUserByID(context.Background(), 1); err == nil {
+				t.Errorf("a user was saved for a rejected registration")
+			}
+		})
+	}
+}
+
+func TestGetUserProfile(t *testing.T) {
+	_, repos := memoryRepositories()
+	router := newRouter(testConfig(), repos, &fakePhones{}, routes.Middlewares{})
+
+	recorder := do(router, http.MethodPost, "/api/v1/user/authenticate", map[string]string{"phone_number": "4155550100"})
+	registered := decode[controllers.RegistrationResponse](t, recorder)
+
+	recorder = do(router, http.MethodGet, "/api/v1/user/profile?userID="+strconv.FormatInt(registered.UserID, 10), nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	profile := decode[controllers.ProfileResponse](t, recorder)
+	if profile.ID != registered.UserID || profile.Phone != "4155550100" || profile.DialingCode != "+61" || profile.IsPhoneVerified {
+		t.Errorf("profile = %+v", profile)
+	}
+	if !reflect.DeepEqual(profile.Location, sydney) {
+		t.Errorf("location = %+v, want %+v", profile.Location, sydney)
+	}
+
+	tests := []struct {
+		query string
+		want  *response.Error
+	}{
+		{"userID=999", response.ErrUserNotFound},
+		{"userID=0", response.ErrUserIDInvalid},
+		{"", response.ErrUserIDInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			expectError(t, do(router, http.MethodGet, "/api/v1/user/profile?"+test.query, nil), test.want)
+		})
+	}
+}
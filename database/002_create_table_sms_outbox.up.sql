@@ -0,0 +1,15 @@
+CREATE TABLE "sms_outbox" (
+  "id" SERIAL PRIMARY KEY,
+  "user_id" BIGINT NOT NULL REFERENCES "user"("id"),
+  "phone_number" VARCHAR(15) NOT NULL,
+  "dialing_code" VARCHAR(8),
+  "message" TEXT NOT NULL,
+  "status" VARCHAR(10) NOT NULL DEFAULT 'pending',
+  "attempts" INTEGER NOT NULL DEFAULT 0,
+  "last_error" TEXT,
+  "next_attempt_at" timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+  "created_at" timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+  "sent_at" timestamp with time zone
+);
+
+CREATE INDEX "sms_outbox_pending_idx" ON "sms_outbox" ("next_attempt_at") WHERE "status" = 'pending';
@@ -0,0 +1,13 @@
+CREATE TABLE "idempotency_key" (
+  "scope" VARCHAR(100) NOT NULL,
+  "key" VARCHAR(255) NOT NULL,
+  "request_hash" CHAR(64) NOT NULL,
+  "status_code" INTEGER,
+  "content_type" VARCHAR(100),
+  "response_body" BYTEA,
+  "created_at" timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "expires_at" timestamp with time zone NOT NULL,
+  PRIMARY KEY ("scope", "key")
+);
+
+CREATE INDEX "idempotency_key_expires_at_idx" ON "idempotency_key" ("expires_at");
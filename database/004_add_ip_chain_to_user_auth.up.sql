@@ -0,0 +1 @@
+ALTER TABLE "user_auth" ADD COLUMN "ip_chain" TEXT[];
@@ -0,0 +1,9 @@
+ALTER TABLE "user_auth"
+  DROP COLUMN IF EXISTS "anonymizer_flags",
+  DROP COLUMN IF EXISTS "as_organization",
+  DROP COLUMN IF EXISTS "asn";
+
+ALTER TABLE "user"
+  DROP COLUMN IF EXISTS "anonymizer_flags",
+  DROP COLUMN IF EXISTS "as_organization",
+  DROP COLUMN IF EXISTS "asn";
@@ -0,0 +1,9 @@
+ALTER TABLE "user"
+  ADD COLUMN "asn" BIGINT,
+  ADD COLUMN "as_organization" TEXT,
+  ADD COLUMN "anonymizer_flags" TEXT[];
+
+ALTER TABLE "user_auth"
+  ADD COLUMN "asn" BIGINT,
+  ADD COLUMN "as_organization" TEXT,
+  ADD COLUMN "anonymizer_flags" TEXT[];
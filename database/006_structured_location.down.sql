@@ -0,0 +1,16 @@
+-- Migrated rows get their original text back from location_legacy. Rows written
+-- since are formatted as the text was, "City, , Country" with ", , " for a failed
+-- lookup, but with the names they were stored with, which may not be English.
+-- The rare rows whose location was NULL before the up migration come back as
+-- ", , ", the text of a failed lookup.
+UPDATE "user"
+SET "location_legacy" = coalesce("location"->>'city', '') || ', , ' || coalesce("location"->>'country', '')
+WHERE "location_legacy" IS NULL;
+ALTER TABLE "user" DROP COLUMN "location";
+ALTER TABLE "user" RENAME COLUMN "location_legacy" TO "location";
+
+UPDATE "user_auth"
+SET "location_legacy" = coalesce("location"->>'city', '') || ', , ' || coalesce("location"->>'country', '')
+WHERE "location_legacy" IS NULL;
+ALTER TABLE "user_auth" DROP COLUMN "location";
+ALTER TABLE "user_auth" RENAME COLUMN "location_legacy" TO "location";
@@ -0,0 +1,320 @@
+-- location was stored as "City, State, Country": State was always empty and
+-- Country the English name MaxMind gives the country, e.g. ", , " when the lookup
+-- failed. It becomes a JSON object, see repository.storedLocation; rows whose
+-- lookup failed become NULL.
+--
+-- Expected loss: the text only ever held the city and the country, so migrated
+-- rows have no subdivision, postal code, coordinates, time zone or network, and
+-- a text not in that format, which no release wrote, becomes NULL. The
+-- country code is looked up by the English name in location_country_code, the
+-- names of the GeoLite2 databases past and present, then in countries; a name
+-- neither knows, e.g. one MaxMind introduces later, is kept without its code.
+--
+-- The text is kept as is in location_legacy, so that the down migration restores
+-- it exactly. It is no longer written and can be dropped once 006 no longer needs
+-- to be rolled back.
+CREATE TEMPORARY TABLE "location_country_code" ("name" TEXT PRIMARY KEY, "iso2" CHAR(2) NOT NULL);
+
+INSERT INTO "location_country_code" ("name", "iso2")
+VALUES
+  ('Andorra', 'AD'),
+  ('United Arab Emirates', 'AE'),
+  ('Afghanistan', 'AF'),
+  ('Antigua and Barbuda', 'AG'),
+  ('Anguilla', 'AI'),
+  ('Albania', 'AL'),
+  ('Armenia', 'AM'),
+  ('Angola', 'AO'),
+  ('Antarctica', 'AQ'),
+  ('Argentina', 'AR'),
+  ('American Samoa', 'AS'),
+  ('Austria', 'AT'),
+  ('Australia', 'AU'),
+  ('Aruba', 'AW'),
+  ('Åland', 'AX'),
+  ('Azerbaijan', 'AZ'),
+  ('Bosnia and Herzegovina', 'BA'),
+  ('Barbados', 'BB'),
+  ('Bangladesh', 'BD'),
+  ('Belgium', 'BE'),
+  ('Burkina Faso', 'BF'),
+  ('Bulgaria', 'BG'),
+  ('Bahrain', 'BH'),
+  ('Burundi', 'BI'),
+  ('Benin', 'BJ'),
+  ('Saint Barthélemy', 'BL'),
+  ('Bermuda', 'BM'),
+  ('Brunei', 'BN'),
+  ('Bolivia', 'BO'),
+  ('Bonaire, Sint Eustatius, and Saba', 'BQ'),
+  ('Brazil', 'BR'),
+  ('Bahamas', 'BS'),
+  ('Bhutan', 'BT'),
+  ('Bouvet Island', 'BV'),
+  ('Botswana', 'BW'),
+  ('Belarus', 'BY'),
+  ('Belize', 'BZ'),
+  ('Canada', 'CA'),
+  ('Cocos (Keeling) Islands', 'CC'),
+  ('DR Congo', 'CD'),
+  ('Central African Republic', 'CF'),
+  ('Congo Republic', 'CG'),
+  ('Switzerland', 'CH'),
+  ('Ivory Coast', 'CI'),
+  ('Cook Islands', 'CK'),
+  ('Chile', 'CL'),
+  ('Cameroon', 'CM'),
+  ('China', 'CN'),
+  ('Colombia', 'CO'),
+  ('Costa Rica', 'CR'),
+  ('Cuba', 'CU'),
+  ('Cabo Verde', 'CV'),
+  ('Curaçao', 'CW'),
+  ('Christmas Island', 'CX'),
+  ('Cyprus', 'CY'),
+  ('Czechia', 'CZ'),
+  ('Germany', 'DE'),
+  ('Djibouti', 'DJ'),
+  ('Denmark', 'DK'),
+  ('Dominica', 'DM'),
+  ('Dominican Republic', 'DO'),
+  ('Algeria', 'DZ'),
+  ('Ecuador', 'EC'),
+  ('Estonia', 'EE'),
+  ('Egypt', 'EG'),
+  ('Western Sahara', 'EH'),
+  ('Eritrea', 'ER'),
+  ('Spain', 'ES'),
+  ('Ethiopia', 'ET'),
+  ('Finland', 'FI'),
+  ('Fiji', 'FJ'),
+  ('Falkland Islands', 'FK'),
+  ('Federated States of Micronesia', 'FM'),
+  ('Faroe Islands', 'FO'),
+  ('France', 'FR'),
+  ('Gabon', 'GA'),
+  ('United Kingdom', 'GB'),
+  ('Grenada', 'GD'),
+  ('Georgia', 'GE'),
+  ('French Guiana', 'GF'),
+  ('Guernsey', 'GG'),
+  ('Ghana', 'GH'),
+  ('Gibraltar', 'GI'),
+  ('Greenland', 'GL'),
+  ('Gambia', 'GM'),
+  ('Guinea', 'GN'),
+  ('Guadeloupe', 'GP'),
+  ('Equatorial Guinea', 'GQ'),
+  ('Greece', 'GR'),
+  ('South Georgia and the South Sandwich Islands', 'GS'),
+  ('Guatemala', 'GT'),
+  ('Guam', 'GU'),
+  ('Guinea-Bissau', 'GW'),
+  ('Guyana', 'GY'),
+  ('Hong Kong', 'HK'),
+  ('Heard Island and McDonald Islands', 'HM'),
+  ('Honduras', 'HN'),
+  ('Croatia', 'HR'),
+  ('Haiti', 'HT'),
+  ('Hungary', 'HU'),
+  ('Indonesia', 'ID'),
+  ('Ireland', 'IE'),
+  ('Israel', 'IL'),
+  ('Isle of Man', 'IM'),
+  ('India', 'IN'),
+  ('British Indian Ocean Territory', 'IO'),
+  ('Iraq', 'IQ'),
+  ('Iran', 'IR'),
+  ('Iceland', 'IS'),
+  ('Italy', 'IT'),
+  ('Jersey', 'JE'),
+  ('Jamaica', 'JM'),
+  ('Hashemite Kingdom of Jordan', 'JO'),
+  ('Japan', 'JP'),
+  ('Kenya', 'KE'),
+  ('Kyrgyzstan', 'KG'),
+  ('Cambodia', 'KH'),
+  ('Kiribati', 'KI'),
+  ('Comoros', 'KM'),
+  ('St Kitts and Nevis', 'KN'),
+  ('North Korea', 'KP'),
+  ('South Korea', 'KR'),
+  ('Kuwait', 'KW'),
+  ('Cayman Islands', 'KY'),
+  ('Kazakhstan', 'KZ'),
+  ('Laos', 'LA'),
+  ('Lebanon', 'LB'),
+  ('Saint Lucia', 'LC'),
+  ('Liechtenstein', 'LI'),
+  ('Sri Lanka', 'LK'),
+  ('Liberia', 'LR'),
+  ('Lesotho', 'LS'),
+  ('Republic of Lithuania', 'LT'),
+  ('Luxembourg', 'LU'),
+  ('Latvia', 'LV'),
+  ('Libya', 'LY'),
+  ('Morocco', 'MA'),
+  ('Monaco', 'MC'),
+  ('Republic of Moldova', 'MD'),
+  ('Montenegro', 'ME'),
+  ('Saint Martin', 'MF'),
+  ('Madagascar', 'MG'),
+  ('Marshall Islands', 'MH'),
+  ('North Macedonia', 'MK'),
+  ('Mali', 'ML'),
+  ('Myanmar', 'MM'),
+  ('Mongolia', 'MN'),
+  ('Macao', 'MO'),
+  ('Northern Mariana Islands', 'MP'),
+  ('Martinique', 'MQ'),
+  ('Mauritania', 'MR'),
+  ('Montserrat', 'MS'),
+  ('Malta', 'MT'),
+  ('Mauritius', 'MU'),
+  ('Maldives', 'MV'),
+  ('Malawi', 'MW'),
+  ('Mexico', 'MX'),
+  ('Malaysia', 'MY'),
+  ('Mozambique', 'MZ'),
+  ('Namibia', 'NA'),
+  ('New Caledonia', 'NC'),
+  ('Niger', 'NE'),
+  ('Norfolk Island', 'NF'),
+  ('Nigeria', 'NG'),
+  ('Nicaragua', 'NI'),
+  ('The Netherlands', 'NL'),
+  ('Norway', 'NO'),
+  ('Nepal', 'NP'),
+  ('Nauru', 'NR'),
+  ('Niue', 'NU'),
+  ('New Zealand', 'NZ'),
+  ('Oman', 'OM'),
+  ('Panama', 'PA'),
+  ('Peru', 'PE'),
+  ('French Polynesia', 'PF'),
+  ('Papua New Guinea', 'PG'),
+  ('Philippines', 'PH'),
+  ('Pakistan', 'PK'),
+  ('Poland', 'PL'),
+  ('Saint Pierre and Miquelon', 'PM'),
+  ('Pitcairn Islands', 'PN'),
+  ('Puerto Rico', 'PR'),
+  ('Palestine', 'PS'),
+  ('Portugal', 'PT'),
+  ('Palau', 'PW'),
+  ('Paraguay', 'PY'),
+  ('Qatar', 'QA'),
+  ('Réunion', 'RE'),
+  ('Romania', 'RO'),
+  ('Serbia', 'RS'),
+  ('Russia', 'RU'),
+  ('Rwanda', 'RW'),
+  ('Saudi Arabia', 'SA'),
+  ('Solomon Islands', 'SB'),
+  ('Seychelles', 'SC'),
+  ('Sudan', 'SD'),
+  ('Sweden', 'SE'),
+  ('Singapore', 'SG'),
+  ('Saint Helena', 'SH'),
+  ('Slovenia', 'SI'),
+  ('Svalbard and Jan Mayen', 'SJ'),
+  ('Slovakia', 'SK'),
+  ('Sierra Leone', 'SL'),
+  ('San Marino', 'SM'),
+  ('Senegal', 'SN'),
+  ('Somalia', 'SO'),
+  ('Suriname', 'SR'),
+  ('South Sudan', 'SS'),
+  ('São Tomé and Príncipe', 'ST'),
+  ('El Salvador', 'SV'),
+  ('Sint Maarten', 'SX'),
+  ('Syria', 'SY'),
+  ('Eswatini', 'SZ'),
+  ('Turks and Caicos Islands', 'TC'),
+  ('Chad', 'TD'),
+  ('French Southern Territories', 'TF'),
+  ('Togo', 'TG'),
+  ('Thailand', 'TH'),
+  ('Tajikistan', 'TJ'),
+  ('Tokelau', 'TK'),
+  ('Timor-Leste', 'TL'),
+  ('Turkmenistan', 'TM'),
+  ('Tunisia', 'TN'),
+  ('Tonga', 'TO'),
+  ('Türkiye', 'TR'),
+  ('Trinidad and Tobago', 'TT'),
+  ('Tuvalu', 'TV'),
+  ('Taiwan', 'TW'),
+  ('Tanzania', 'TZ'),
+  ('Ukraine', 'UA'),
+  ('Uganda', 'UG'),
+  ('U.S. Outlying Islands', 'UM'),
+  ('United States', 'US'),
+  ('Uruguay', 'UY'),
+  ('Uzbekistan', 'UZ'),
+  ('Vatican City', 'VA'),
+  ('St Vincent and Grenadines', 'VC'),
+  ('Venezuela', 'VE'),
+  ('British Virgin Islands', 'VG'),
+  ('U.S. Virgin Islands', 'VI'),
+  ('Vietnam', 'VN'),
+  ('Vanuatu', 'VU'),
+  ('Wallis and Futuna', 'WF'),
+  ('Samoa', 'WS'),
+  ('Kosovo', 'XK'),
+  ('Yemen', 'YE'),
+  ('Mayotte', 'YT'),
+  ('South Africa', 'ZA'),
+  ('Zambia', 'ZM'),
+  ('Zimbabwe', 'ZW'),
+  ('Republic of the Congo', 'CG'),
+  ('Cape Verde', 'CV'),
+  ('Czech Republic', 'CZ'),
+  ('Macedonia', 'MK'),
+  ('Macau', 'MO'),
+  ('Swaziland', 'SZ'),
+  ('Turkey', 'TR');
+
+ALTER TABLE "user" ADD COLUMN "location_details" JSONB;
+
+UPDATE "user" AS u
+SET "location_details" = NULLIF(jsonb_strip_nulls(jsonb_build_object(
+  'city', p."city",
+  'country', p."country",
+  'country_code', COALESCE(n."iso2", (SELECT c.iso2 FROM countries AS c WHERE lower(c.name) = lower(p."country") LIMIT 1))
+)), '{}'::jsonb)
+FROM (
+  SELECT "id",
+    NULLIF(left("location", strpos("location", ', , ') - 1), '') AS "city",
+    NULLIF(substr("location", strpos("location", ', , ') + 4), '') AS "country"
+  FROM "user"
+  WHERE strpos("location", ', , ') > 0
+) AS p
+LEFT JOIN "location_country_code" AS n ON n."name" = p."country"
+WHERE u."id" = p."id";
+
+ALTER TABLE "user" RENAME COLUMN "location" TO "location_legacy";
+ALTER TABLE "user" RENAME COLUMN "location_details" TO "location";
+
+ALTER TABLE "user_auth" ADD COLUMN "location_details" JSONB;
+
+UPDATE "user_auth" AS a
+SET "location_details" = NULLIF(jsonb_strip_nulls(jsonb_build_object(
+  'city', p."city",
+  'country', p."country",
+  'country_code', COALESCE(n."iso2", (SELECT c.iso2 FROM countries AS c WHERE lower(c.name) = lower(p."country") LIMIT 1))
+)), '{}'::jsonb)
+FROM (
+  SELECT "id",
+    NULLIF(left("location", strpos("location", ', , ') - 1), '') AS "city",
+    NULLIF(substr("location", strpos("location", ', , ') + 4), '') AS "country"
+  FROM "user_auth"
+  WHERE strpos("location", ', , ') > 0
+) AS p
+LEFT JOIN "location_country_code" AS n ON n."name" = p."country"
+WHERE a."id" = p."id";
+
+ALTER TABLE "user_auth" RENAME COLUMN "location" TO "location_legacy";
+ALTER TABLE "user_auth" RENAME COLUMN "location_details" TO "location";
+
+DROP TABLE "location_country_code";
@@ -0,0 +1 @@
+-- The cleared messages cannot be restored, and are not needed once sent.
@@ -0,0 +1,4 @@
+-- The SMS of the outbox carry the OTP. Once an SMS is sent or given up on its
+-- message is cleared, see repository.MarkSMSSent; this clears the rows marked
+-- before that was the case.
+UPDATE "sms_outbox" SET "message" = '' WHERE "status" IN ('sent', 'failed');
@@ -0,0 +1,27 @@
+// Package database holds the SQL migrations of the service, applied in order of
+// their numeric prefix with golang-migrate, which records progress in schema_migrations.
+package database
+
+import (
+	"embed"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.up.sql
+var migrations embed.FS
+
+// LatestVersion returns the version of the newest migration shipped with this build.
+func LatestVersion() int64 {
+	entries, _ := migrations.ReadDir(".")
+
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,137 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"we-credit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logger = logging.For("health")
+
+// Check reports whether a dependency is usable. A nil error means it is ready.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single readiness check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the body of the readiness response on the admin listener.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// PublicReport is the body of the readiness response on the public listener. It
+// only tells whether each check passed: check errors may carry database hosts,
+// file paths or schema versions that unauthenticated clients must not see.
+type PublicReport struct {
+	Status string `json:"status"`
+	// Checks maps the name of every check to "ok" or "fail".
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	statusFail        = "fail"
+)
+
+// Checker runs the registered readiness checks concurrently, each bounded by timeout.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecker returns a Checker without any check; every check gets at most timeout to complete.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name. It must be called before the checker serves requests.
+func (h *Checker) Add(name string, check Check) {
+	if _, found := h.checks[name]; !found {
+		h.names = append(h.names, name)
+		sort.Strings(h.names)
+	}
+	h.checks[name] = check
+}
+
+// Run executes every check and returns the combined report.
+// The report is ready only when every check passed.
+func (h *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	results := make([]Result, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			results[i] = Result{Status: statusOK, DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				results[i].Status = statusUnavailable
+				results[i].Error = err.Error()
+			}
+		}(i, h.checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: statusOK, Checks: make(map[string]Result, len(h.names))}
+	for i, name := range h.names {
+		report.Checks[name] = results[i]
+		if results[i].Status != statusOK {
+			report.Status = statusUnavailable
+		}
+	}
+	return report
+}
+
+// Liveness answers 200 as long as the process is able to serve HTTP requests.
+// It checks no dependency, so that an outage of e.g. Postgres does not get the process restarted.
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": statusOK})
+}
+
+// Readiness answers 200 with the result of every check when the service can take
+// traffic, or 503 with the same breakdown when at least one dependency is not ready.
+// The breakdown includes the errors of the checks, it is only served on the admin listener.
+func (h *Checker) Readiness(c *gin.Context) {
+	report := h.Run(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// PublicReadiness answers like Readiness with a PublicReport, for the probes
+// reaching the public listener. The errors of the failed checks are logged instead.
+func (h *Checker) PublicReadiness(c *gin.Context) {
+	report := h.Run(c.Request.Context())
+	public := PublicReport{Status: report.Status, Checks: make(map[string]string, len(report.Checks))}
+	for name, result := range report.Checks {
+		public.Checks[name] = statusOK
+		if result.Status != statusOK {
+			public.Checks[name] = statusFail
+			logger.WarnContext(c.Request.Context(), "Readiness: check failed", "check", name, "error", result.Error)
+		}
+	}
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, public)
+}
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublicReadinessHidesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := NewChecker(time.Second)
+	checker.Add("postgres", func(context.Context) error {
+		return errors.New("dial tcp db.internal:5432: connection refused")
+	})
+	checker.Add("geoip", func(context.Context) error { return nil })
+
+	router := gin.New()
+	router.GET("/public", checker.PublicReadiness)
+	router.GET("/admin", checker.Readiness)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/public", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", recorder.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "db.internal") {
+		t.Errorf("public body %s leaks the check error", recorder.Body)
+	}
+	var public PublicReport
+	err := json.Unmarshal(recorder.Body.Bytes(), &public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.Status != statusUnavailable || public.Checks["postgres"] != statusFail || public.Checks["geoip"] != statusOK {
+		t.Errorf("public report = %+v", public)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if !strings.Contains(recorder.Body.String(), "connection refused") {
+		t.Errorf("admin body %s does not explain the failure", recorder.Body)
+	}
+}
@@ -0,0 +1,158 @@
+// Package idempotency lets clients retry requests that must not be repeated,
+// such as sending an OTP, with an Idempotency-Key header: the first request is
+// handled and its response stored, retries within the window get that response
+// back without reaching the handler again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"we-credit/logging"
+	"we-credit/models"
+	"we-credit/repository"
+	"we-credit/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logger = logging.For("idempotency")
+
+// Header is the request header carrying the idempotency key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set to "true" on responses replayed from a previous request.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// lease is how long a request holds its key before it is stored with its response.
+// A key whose request died, e.g. with the instance, can be used again after it.
+const lease = time.Minute
+
+// maxKeyLength is the length of the key column.
+const maxKeyLength = 255
+
+// Middleware makes the routes it is added to idempotent for requests carrying
+// Header; requests without it are handled as usual. Keys are scoped to the route
+// stripped of versionPrefix, so that a route mounted both under the current
+// version and at its legacy path shares its keys, and the response is replayed
+// for ttl from the first request. Server errors are not stored, so the client
+// can retry them with the same key.
+func Middleware(repo repository.IdempotencyRepository, ttl time.Duration, versionPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validKey(key) {
+			response.Fail(c, response.ErrIdempotencyInvalid)
+			return
+		}
+
+		ctx := c.Request.Context()
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			response.Fail(c, response.ErrInvalidRequest.Wrap(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+
+		claim := models.IdempotencyKey{Scope: strings.TrimPrefix(c.FullPath(), versionPrefix), Key: key, RequestHash: hex.EncodeToString(hash[:])}
+		stored, claimed, err := repo.ClaimIdempotencyKey(ctx, claim, lease)
+		if err != nil {
+			response.Fail(c, err)
+			return
+		}
+		if !claimed {
+			replay(c, claim, stored)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// the outcome is recorded even if the client went away, its retry is what needs it
+		ctx = context.WithoutCancel(ctx)
+		if recorder.Status() >= http.StatusInternalServerError {
+			_ = repo.ReleaseIdempotencyKey(ctx, claim.Scope, claim.Key)
+			return
+		}
+		claim.StatusCode = recorder.Status()
+		claim.ContentType = recorder.Header().Get("Content-Type")
+		claim.Body = recorder.body.Bytes()
+		err = repo.CompleteIdempotencyKey(ctx, claim, ttl)
+		if err != nil {
+			// without the response retries would wait for the lease, let them through instead
+			_ = repo.ReleaseIdempotencyKey(ctx, claim.Scope, claim.Key)
+		}
+	}
+}
+
+// replay answers a request whose key is held by an earlier request.
+func replay(c *gin.Context, claim, stored models.IdempotencyKey) {
+	switch {
+	case stored.RequestHash != "" && stored.RequestHash != claim.RequestHash:
+		response.Fail(c, response.ErrIdempotencyReused)
+	case !stored.Completed():
+		response.Fail(c, response.ErrIdempotencyPending)
+	default:
+		logger.InfoContext(c.Request.Context(), "Middleware: replaying stored response", "scope", claim.Scope, "status", stored.StatusCode)
+		c.Header(ReplayedHeader, "true")
+		c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+		c.Abort()
+	}
+}
+
+// validKey reports whether key fits the key column and is printable ASCII.
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cleanup deletes the expired keys every interval until ctx is cancelled.
+func Cleanup(ctx context.Context, repo repository.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx)
+			if err == nil && deleted > 0 {
+				logger.DebugContext(ctx, "Cleanup: deleted expired keys", "deleted", deleted)
+			}
+		}
+	}
+}
+
+// bodyRecorder keeps a copy of the response body to store it.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,57 @@
+package idempotency_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"we-credit/idempotency"
+	"we-credit/logging"
+	"we-credit/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	logging.Setup(logging.Options{Output: io.Discard, Level: slog.LevelError})
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRetriesAreReplayedAcrossVersions(t *testing.T) {
+	handled := 0
+	router := gin.New()
+	idempotent := idempotency.Middleware(repository.NewMemory(), time.Hour, "/api/v1")
+	for _, path := range []string{"/api/v1/user/otp/send", "/user/otp/send", "/user/authenticate"} {
+		router.POST(path, idempotent, func(c *gin.Context) {
+			handled++
+			c.JSON(http.StatusOK, gin.H{"handled": handled})
+		})
+	}
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"phone_number": "4155550100"}`))
+		req.Header.Set(idempotency.Header, "retry-1")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first := send("/api/v1/user/otp/send")
+	if first.Code != http.StatusOK || handled != 1 {
+		t.Fatalf("status = %d after %d calls, want the first request handled: %s", first.Code, handled, first.Body)
+	}
+	retry := send("/user/otp/send")
+	if retry.Header().Get(idempotency.ReplayedHeader) != "true" || retry.Body.String() != first.Body.String() || handled != 1 {
+		t.Errorf("retry on the legacy path = %d %s after %d calls, want the first response replayed", retry.Code, retry.Body, handled)
+	}
+
+	// the key is still free on another operation
+	other := send("/user/authenticate")
+	if other.Header().Get(idempotency.ReplayedHeader) != "" || handled != 2 {
+		t.Errorf("another route = %d %s after %d calls, want it handled", other.Code, other.Body, handled)
+	}
+}
@@ -0,0 +1,173 @@
+// Package logging writes structured JSON logs through log/slog. Every package logs
+// through its own logger from For, so that its level can be tuned on its own, and
+// every line logged with a request context carries the X-Request-ID of that request
+// and, when the request is traced, its trace and span ids.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options configures the process wide logger.
+type Options struct {
+	// Output receives one JSON object per line; os.Stdout when nil.
+	Output io.Writer
+	// Level is the minimum level of packages without an entry in Packages.
+	Level slog.Level
+	// Packages overrides Level per package, keyed by the name given to For.
+	Packages map[string]slog.Level
+	// Policy masks sensitive attributes; nil logs every value as is.
+	Policy Policy
+}
+
+// state is what Setup installs; loggers returned by For read it on every call,
+// so loggers created in package variables pick up the configuration set later in main.
+type state struct {
+	handler  slog.Handler
+	level    slog.Level
+	packages map[string]slog.Level
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	Setup(Options{Level: slog.LevelInfo, Policy: DefaultPolicy()})
+}
+
+// Setup installs opts as the configuration of every logger, including the
+// standard library log package and slog's default logger.
+func Setup(opts Options) {
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	handler := slog.NewJSONHandler(output, &slog.HandlerOptions{
+		// levels are filtered per package before records reach the handler
+		Level:       slog.LevelDebug,
+		ReplaceAttr: opts.Policy.replaceAttr,
+	})
+	current.Store(&state{handler: handler, level: opts.Level, packages: opts.Packages})
+	slog.SetDefault(For("default"))
+}
+
+// Levels returns the default level and a copy of the per package overrides in effect.
+func Levels() (slog.Level, map[string]slog.Level) {
+	s := current.Load()
+	packages := make(map[string]slog.Level, len(s.packages))
+	for pkg, level := range s.packages {
+		packages[pkg] = level
+	}
+	return s.level, packages
+}
+
+// SetLevels replaces the default level and the per package overrides at runtime,
+// e.g. to debug a single package in production without a restart.
+func SetLevels(level slog.Level, packages map[string]slog.Level) {
+	for {
+		old := current.Load()
+		next := &state{handler: old.handler, level: level, packages: packages}
+		if current.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// For returns the logger of the named package.
+func For(pkg string) *slog.Logger {
+	return slog.New(&packageHandler{pkg: pkg})
+}
+
+// ParseLevels parses the default level, e.g. "info", and the per package
+// overrides, e.g. "repository=debug,outbox=warn".
+func ParseLevels(level, packages string) (slog.Level, map[string]slog.Level, error) {
+	var def slog.Level
+	err := def.UnmarshalText([]byte(level))
+	if err != nil {
+		return def, nil, fmt.Errorf("%q is not a log level (debug, info, warn, error)", level)
+	}
+
+	overrides := map[string]slog.Level{}
+	for _, entry := range strings.Split(packages, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, name, found := strings.Cut(entry, "=")
+		var lvl slog.Level
+		if !found || strings.TrimSpace(pkg) == "" || lvl.UnmarshalText([]byte(strings.TrimSpace(name))) != nil {
+			return def, nil, fmt.Errorf("%q is not a package=level pair", entry)
+		}
+		overrides[strings.TrimSpace(pkg)] = lvl
+	}
+	return def, overrides, nil
+}
+
+// packageHandler filters records by the level of its package and forwards them,
+// tagged with the package and the request id, to the handler installed by Setup.
+type packageHandler struct {
+	pkg string
+	// ops replays WithAttrs and WithGroup on the current handler, in order.
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *packageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	s := current.Load()
+	min, found := s.packages[h.pkg]
+	if !found {
+		min = s.level
+	}
+	return level >= min
+}
+
+func (h *packageHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := []slog.Attr{slog.String("package", h.pkg)}
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	handler := current.Load().handler.WithAttrs(attrs)
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *packageHandler) with(op func(slog.Handler) slog.Handler) *packageHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &packageHandler{pkg: h.pkg, ops: append(ops, op)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id carried by ctx, or "" outside of a request.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Redactor replaces a sensitive value by a masked one.
+type Redactor func(value string) string
+
+// Policy maps attribute keys, matched case-insensitively, to the Redactor applied
+// to their values. Messages and errors are additionally scrubbed of phone numbers,
+// IP addresses and JWTs, as third party errors (e.g. from Twilio or a unique
+// constraint of Postgres) often quote the value they failed on, see Scrub.
+type Policy map[string]Redactor
+
+// DefaultPolicy masks phone numbers, OTPs, tokens and client IPs.
+func DefaultPolicy() Policy {
+	return Policy{
+		"phone":             MaskPhone,
+		"phone_number":      MaskPhone,
+		"to":                MaskPhone,
+		"otp":               Hide,
+		"code":              Hide,
+		"verification_code": Hide,
+		"token":             Hide,
+		"jwt":               Hide,
+		"authorization":     Hide,
+		"cookie":            Hide,
+		"password":          Hide,
+		"secret":            Hide,
+		"ip":                MaskIP,
+		"client_ip":         MaskIP,
+		"user_ip":           MaskIP,
+	}
+}
+
+// Hide drops the value entirely.
+func Hide(string) string {
+	return "[REDACTED]"
+}
+
+// MaskPhone keeps the last two digits of a phone number, enough to tell numbers apart while debugging.
+func MaskPhone(value string) string {
+	if len(value) <= 2 {
+		return Hide(value)
+	}
+	return strings.Repeat("*", len(value)-2) + value[len(value)-2:]
+}
+
+// MaskIP zeroes the host part of an address: IPv4 addresses keep their /24, IPv6 addresses their /48.
+func MaskIP(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return Hide(value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+var (
+	jwtPattern           = regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]*`)
+	ipv6Pattern          = regexp.MustCompile(`[0-9A-Fa-f.]*:[0-9A-Fa-f.]*:[0-9A-Fa-f.:]*`)
+	ipv4Pattern          = regexp.MustCompile(`\b(\d{1,3}\.\d{1,3}\.\d{1,3})\.\d{1,3}\b`)
+	phonePattern         = regexp.MustCompile(`\+[1-9]\d{6,14}\b`)
+	nationalPhonePattern = regexp.MustCompile(`\b[2-9]\d{9}\b`)
+)
+
+// Scrub masks the sensitive values embedded in free text, e.g. an error message. Phone numbers are
+// recognized in E.164 form, a + then 7 to 15 digits, the first not 0, and in the
+// national form the API takes, 10 digits. National numbers never start with 0 or
+// 1 (area codes and mobile prefixes start at 2), so that durations in ns and unix
+// times, which start with 1, stay readable; ids and dates are not 10 digit runs.
+func Scrub(text string) string {
+	text = jwtPattern.ReplaceAllString(text, Hide(""))
+	text = ipv6Pattern.ReplaceAllStringFunc(text, maskIPv6)
+	text = ipv4Pattern.ReplaceAllString(text, "$1.0")
+	text = phonePattern.ReplaceAllStringFunc(text, MaskPhone)
+	return nationalPhonePattern.ReplaceAllStringFunc(text, MaskPhone)
+}
+
+// maskIPv6 masks candidate, a run of hex digits, dots and colons, when it is an
+// IPv6 address, possibly followed by the punctuation of the text, e.g. "::1:".
+// Other runs, e.g. times, are returned as is.
+func maskIPv6(candidate string) string {
+	for address := candidate; address != ""; address = address[:len(address)-1] {
+		if strings.Contains(address, ":") && net.ParseIP(address) != nil {
+			return MaskIP(address) + candidate[len(address):]
+		}
+		if !strings.HasSuffix(address, ".") && !strings.HasSuffix(address, ":") {
+			break
+		}
+	}
+	return candidate
+}
+
+// replaceAttr applies the policy to a single attribute, see slog.HandlerOptions.ReplaceAttr.
+func (p Policy) replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(p) == 0 {
+		return attr
+	}
+	if len(groups) == 0 && attr.Key == slog.MessageKey {
+		return slog.String(attr.Key, Scrub(attr.Value.String()))
+	}
+
+	if redact, found := p[strings.ToLower(attr.Key)]; found {
+		return slog.String(attr.Key, redact(attr.Value.String()))
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, Scrub(err.Error()))
+		}
+	}
+	if attr.Key == "error" {
+		return slog.String(attr.Key, Scrub(attr.Value.String()))
+	}
+	return attr
+}
@@ -1,30 +1,229 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"we-credit/config"
+	"we-credit/controllers"
+	"we-credit/health"
+	"we-credit/idempotency"
+	"we-credit/logging"
+	"we-credit/metrics"
+	"we-credit/openapi"
+	"we-credit/outbox"
+	"we-credit/repository"
 	"we-credit/routes"
-
-	"github.com/gin-contrib/pprof"
-	"github.com/joho/godotenv"
+	"we-credit/service"
+	"we-credit/tracing"
 )
 
-// @title Tutree Swagger API
-// @version 2.0
-// @description This is swagger api for Tutree.
-// @BasePath /api
-// @schemes http https
+var logger = logging.For("main")
+
 func main() {
 
-	err := godotenv.Load()
+	// load and validate the whole configuration once, every problem is reported at the same time
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+	// validated by config.Load
+	logOptions, _ := cfg.Log.Options()
+	logging.Setup(logOptions)
+
+	err = run(cfg)
 	if err != nil {
+		logger.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+}
 
-		log.Fatal("Error loading .env file -> ", err)
+// run serves the API until SIGINT or SIGTERM is received, then drains in-flight
+// requests and queued SMS within cfg.Server.ShutdownTimeout and releases the database.
+func run(cfg config.Config) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("error setting up tracing -> %w", err)
+	}
+	// flush the spans of the drained requests last
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			logger.Error("Shutdown: failed to flush traces", "error", err)
+		}
+	}()
+
+	// create the shared connection pool once and hand it to the repository layer
+	db, err := config.OpenDB(cfg.DB)
+	if err != nil {
+		return fmt.Errorf("error connecting to the database -> %w", err)
+	}
+	defer db.Close()
+	err = metrics.RegisterDB(db, "primary")
+	if err != nil {
+		return fmt.Errorf("error registering database metrics -> %w", err)
+	}
+	repo := repository.NewPostgres(db, cfg.DB.QueryTimeout)
+	defer repo.Close()
+
+	// background work (outbox delivery, replica health checks) stops when ctx is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var background sync.WaitGroup
+
+	// read-only queries go to the replica when one is configured; an unreachable
+	// replica at boot is not fatal, reads simply stay on the primary
+	if cfg.DB.HasReplica() {
+		replicaDB, err := config.OpenDB(cfg.DB.Replica())
+		if err != nil {
+			logger.Warn("Read replica unavailable, serving reads from the primary", "error", err)
+		} else {
+			defer replicaDB.Close()
+			err = metrics.RegisterDB(replicaDB, "replica")
+			if err != nil {
+				return fmt.Errorf("error registering replica metrics -> %w", err)
+			}
+			repo.UseReplica(replicaDB, cfg.DB.ReplicaMaxLag)
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				repo.MonitorReplica(ctx, cfg.DB.ReplicaCheckInterval)
+			}()
+		}
+	}
+
+	// the GeoIP database is opened once and swapped when geoipupdate replaces the file
+	geoIP := service.NewGeoIP(cfg.GeoIP)
+	defer geoIP.Close()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		geoIP.Watch(ctx)
+	}()
+
+	twilio := service.NewTwilio(cfg.Twilio)
+	ctrl := controllers.NewController(cfg, controllers.Repositories{
+		Users:         repo,
+		OTPs:          repo,
+		Sessions:      repo,
+		Countries:     repo,
+		Registrations: repo,
+	}, twilio, geoIP)
+
+	// deliver the verification sms queued by registrations in the background
+	dispatcher := outbox.NewDispatcher(repo, twilio.SendMessage, cfg.Outbox.PollInterval, cfg.Outbox.BatchSize, cfg.Outbox.MaxAttempts)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	// forget the responses stored for retries once their window is over
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		idempotency.Cleanup(ctx, repo, cfg.Idempotency.CleanupInterval)
+	}()
+
+	// /readyz reports ready only while every dependency needed to register and sign in users is usable
+	checker := health.NewChecker(cfg.Server.ReadinessTimeout)
+	checker.Add("postgres", repo.Ping)
+	checker.Add("migrations", repo.CheckMigrations)
+	checker.Add("geoip", geoIP.Check)
+	checker.Add("sms", twilio.CheckConfigured)
+
+	// the OpenAPI document is generated from the request and response types of the handlers
+	spec, err := openapi.Spec(routes.UserPrefixes()...)
+	if err != nil {
+		return fmt.Errorf("error generating the OpenAPI document -> %w", err)
+	}
+	validate, err := openapi.Middleware(spec, cfg.OpenAPI)
+	if err != nil {
+		return fmt.Errorf("error setting up OpenAPI validation -> %w", err)
 	}
 
 	//setup routes
-	r := routes.SetupRouter()
-	pprof.Register(r)
+	router := routes.SetupRouter(cfg, ctrl, checker, routes.Middlewares{
+		Validate:   validate,
+		Idempotent: idempotency.Middleware(repo, cfg.Idempotency.TTL, routes.APIPrefix),
+	})
+	err = openapi.CheckRoutes(spec, router.Routes())
+	if err != nil {
+		return fmt.Errorf("the OpenAPI document is out of date -> %w", err)
+	}
+	server := newServer(":"+strconv.Itoa(cfg.Server.Port), router, cfg.Server)
+	servers := []*http.Server{server}
+
+	// pprof, the OpenAPI document, metrics and the admin apis are only served on the admin listener
+	if cfg.Admin.Addr != "" {
+		if !cfg.Admin.HasAuth() {
+			logger.Warn("Admin listener is not protected, set ADMIN_TOKEN or ADMIN_USERNAME and ADMIN_PASSWORD", "addr", cfg.Admin.Addr)
+		}
+		admin := newServer(cfg.Admin.Addr, routes.SetupAdminRouter(cfg, checker, spec), cfg.Server)
+		// CPU profiles and traces stream for as long as the ?seconds parameter asks
+		admin.WriteTimeout = 0
+		servers = append(servers, admin)
+	}
+
 	// running
-	r.Run(":" + os.Getenv("PORT"))
+	serverErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			serverErr <- srv.ListenAndServe()
+		}(srv)
+	}
+
+	stop, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("error running the server -> %w", err)
+	case <-stop.Done():
+		logger.Info("Shutting down, draining in-flight requests")
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// stop accepting connections and wait for in-flight requests, e.g. OTP verifications, to finish
+	for _, srv := range servers {
+		err = srv.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Warn("Shutdown: in-flight requests did not finish in time", "addr", srv.Addr, "error", err)
+		}
+	}
+
+	// stop the background loops, then deliver whatever the drained requests queued
+	cancel()
+	background.Wait()
+	err = dispatcher.Flush(shutdownCtx)
+	if err != nil {
+		logger.Error("Shutdown: failed to flush the sms outbox", "error", err)
+	}
+
+	logger.Info("Shutdown complete")
+	// the deferred calls close the prepared statements and the connection pools
+	return nil
+}
+
+// newServer returns an http.Server serving handler on addr with the limits of the server configuration.
+func newServer(addr string, handler http.Handler, cfg config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 }
@@ -0,0 +1,104 @@
+// Package metrics exposes the Prometheus metrics of the service: HTTP latency per
+// route, the authentication funnel (registrations, OTP sends and verifications,
+// sessions, phone lookups) and the database connection pools.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wecredit"
+
+// registry holds every metric of the service, plus the Go runtime and process collectors.
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the HTTP requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Registrations counts the outcome of every call to /authenticate.
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Registration attempts by result: created, existing, invalid_phone, undeliverable, voip_rejected, failed.",
+	}, []string{"result"})
+
+	// OTPSends counts the OTP messages handed to a provider.
+	OTPSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "otp_sends_total",
+		Help:      "OTP messages sent by channel, provider, country dialing code and result (sent, failed).",
+	}, []string{"channel", "provider", "country", "result"})
+
+	// OTPVerifications counts the outcome of every call to /otp/verify.
+	OTPVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "otp_verifications_total",
+		Help:      "OTP verifications by result: success, failure, expired.",
+	}, []string{"result"})
+
+	// SessionsCreated counts the sessions stored after a successful verification.
+	SessionsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_created_total",
+		Help:      "Sessions created after a successful OTP verification.",
+	})
+
+	// PhoneLookups counts the phone number lookups made against the provider.
+	PhoneLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "phone_lookups_total",
+		Help:      "Phone number lookups by lookup (deliverability, line_type) and result (deliverable, undeliverable, voip, not_voip, error).",
+	}, []string{"lookup", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		Registrations,
+		OTPSends,
+		OTPVerifications,
+		SessionsCreated,
+		PhoneLookups,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db, labelled with name (e.g. primary, replica).
+func RegisterDB(db *sql.DB, name string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// Middleware records the latency of every request. Requests that match no route
+// are recorded under the "unmatched" route, so that scanners cannot blow up the label cardinality.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
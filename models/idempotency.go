@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// IdempotencyKey is a request made with an Idempotency-Key header and, once
+// the handler has answered it, the response replayed to retries of that request.
+type IdempotencyKey struct {
+	// Scope is the route the key was used on, without its version prefix; the same key may be reused on another route.
+	Scope string
+	Key   string
+	// RequestHash is the hex SHA-256 of the request body, so a key reused for another request is detected.
+	RequestHash string
+
+	// StatusCode is zero while the first request is still being handled.
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Completed reports whether the response of the request has been stored.
+func (key IdempotencyKey) Completed() bool {
+	return key.StatusCode != 0
+}
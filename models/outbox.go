@@ -0,0 +1,11 @@
+package models
+
+// OutboxSMS is an SMS queued in the sms_outbox table waiting to be delivered.
+type OutboxSMS struct {
+	ID          int64  `json:"id"`
+	UserID      int64  `json:"user_id"`
+	Phone       string `json:"phone"`
+	DialingCode string `json:"dialing_code"`
+	Message     string `json:"-"`
+	Attempts    int    `json:"attempts"`
+}
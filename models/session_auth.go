@@ -1,9 +1,8 @@
 package models
 
 import (
-	"log"
 	"time"
-	"we-credit/config"
+	"we-credit/service"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -13,44 +12,16 @@ type JWTAuthClaims struct {
 	jwt.StandardClaims
 }
 
-// CreateNewSession function to insert user session into table
-// Parameter -
-// user id : id of user type int.
-// validUntil : Time of validation for OTP type time.Time.
-// token  : Token is
-// userAgent: The user agent contains information about the client making the request to the web server.
-// userIP: ip address of user
-// location : location of user
-// Return -
-// success or error
-func CreateNewSession(userID int64, validUntil time.Time, token, userAgent, userIP, location, device string) error {
-	db, err := config.GetDB2()
-	if err != nil {
-		log.Println("CreateNewSession: Failed while connecting with the database :", err)
-		return err
-	}
-	defer db.Close()
-
-	sqlInsert := `
-	INSERT INTO 
-		user_auth (
-			user_id,
-			jwt_token,
-			valid_until,
-			browser,
-			ip,
-			location,
-			device_info,
-			created_at
-		)
-	VALUES 
-		($1, $2,$3,$4,$5,$6,$7,NOW())
-	RETURNING id`
-
-	_, err = db.Exec(sqlInsert, userID, token, validUntil, userAgent, userIP, location, device)
-	if err != nil {
-		log.Println("CreateNewSession: failed while executing query with error:", err)
-		return err
-	}
-	return nil
+// Session represents an authenticated user session stored in the user_auth table.
+type Session struct {
+	UserID     int64     `json:"user_id"`
+	Token      string    `json:"-"`
+	ValidUntil time.Time `json:"valid_until"`
+	Browser    string    `json:"browser"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	// Location is where IP is located, with its operator and whether it is an anonymizer for fraud screening.
+	Location service.Location `json:"location"`
+	// IPChain is every hop the request went through as received, the client first, see clientip.Client.
+	IPChain []string `json:"ip_chain"`
 }
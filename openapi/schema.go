@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of t. Struct properties are named after tagKey,
+// "json" or "form", and constrained by the binding tags used by the handlers.
+// In responses every field without omitempty is required, so that response
+// validation catches fields the handlers stop sending.
+func schemaFor(t reflect.Type, tagKey string, response bool) *openapi3.Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return openapi3.NewDateTimeSchema()
+	case t.Kind() == reflect.String:
+		return openapi3.NewStringSchema()
+	case t.Kind() == reflect.Bool:
+		return openapi3.NewBoolSchema()
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int32:
+		return openapi3.NewInt32Schema()
+	case t.Kind() == reflect.Int64:
+		return openapi3.NewInt64Schema()
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return openapi3.NewInt64Schema().WithMin(0)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return openapi3.NewFloat64Schema()
+	case t.Kind() == reflect.Slice:
+		return openapi3.NewArraySchema().WithItems(schemaFor(t.Elem(), tagKey, response))
+	case t.Kind() == reflect.Map:
+		return openapi3.NewObjectSchema().WithAdditionalProperties(schemaFor(t.Elem(), tagKey, response))
+	case t.Kind() == reflect.Struct:
+		return structSchema(t, tagKey, response)
+	}
+	return &openapi3.Schema{}
+}
+
+// structSchema returns the object schema of the struct t, see schemaFor.
+func structSchema(t reflect.Type, tagKey string, response bool) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema()
+	for _, field := range fields(t, tagKey) {
+		property := schemaFor(field.Type, tagKey, response)
+		constrain(property, field.Tag.Get("binding"))
+		schema.WithProperty(field.name, property)
+
+		if field.required(response) {
+			schema.Required = append(schema.Required, field.name)
+		}
+	}
+	return schema
+}
+
+// field is an exported struct field with the name it has on the wire.
+type field struct {
+	reflect.StructField
+	name      string
+	omitempty bool
+}
+
+func (f field) required(response bool) bool {
+	if response {
+		return !f.omitempty
+	}
+	return hasRule(f.Tag.Get("binding"), "required")
+}
+
+// fields returns the fields of t that are encoded under tagKey. The fields of
+// untagged embedded structs are promoted, as encoding/json does.
+func fields(t reflect.Type, tagKey string) []field {
+	var result []field
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get(tagKey)
+		if structField.Anonymous && tag == "" && structField.Type.Kind() == reflect.Struct {
+			result = append(result, fields(structField.Type, tagKey)...)
+			continue
+		}
+		if !structField.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = structField.Name
+		}
+		result = append(result, field{StructField: structField, name: name, omitempty: strings.Contains(options, "omitempty")})
+	}
+	return result
+}
+
+// constrain translates the validator rules the handlers bind with into schema constraints.
+func constrain(schema *openapi3.Schema, binding string) {
+	for _, rule := range strings.Split(binding, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		value, _ := strconv.ParseUint(param, 10, 64)
+		isString := schema.Type.Is(openapi3.TypeString)
+
+		switch {
+		case name == "number" && isString:
+			schema.Pattern = "^[0-9]+$"
+		case name == "len" && isString:
+			schema.MinLength, schema.MaxLength = value, &value
+		case name == "max" && isString:
+			schema.MaxLength = &value
+		case name == "min" && isString:
+			schema.MinLength = value
+		case name == "gt" && !isString:
+			min := float64(value)
+			schema.Min, schema.ExclusiveMin = &min, true
+		}
+	}
+}
+
+// hasRule reports whether the binding tag contains rule.
+func hasRule(binding, rule string) bool {
+	for _, r := range strings.Split(binding, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
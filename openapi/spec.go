@@ -0,0 +1,226 @@
+// Package openapi describes the public API as an OpenAPI 3 document generated
+// from the request and response types of package controllers, and validates
+// traffic against it so that the document cannot drift from the handlers.
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"we-credit/controllers"
+	"we-credit/idempotency"
+	"we-credit/response"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// operation describes one route of the public API.
+type operation struct {
+	method  string
+	path    string
+	id      string
+	tag     string
+	summary string
+	// request is the body of the operation, query its query parameters; at most one is set.
+	request any
+	query   any
+	// response is the body of a successful call, errors the failures the handler may answer.
+	response any
+	errors   []*response.Error
+	// invalid maps the fields of request or query to the error the handler answers
+	// when they fail validation, as the handler passes them to controllers' bindError.
+	invalid map[string]*response.Error
+	// idempotent operations accept an Idempotency-Key header, see package idempotency.
+	idempotent bool
+}
+
+// operations lists every route added by routes.AddRoutes, relative to the servers of the document.
+var operations = []operation{
+	{
+		method:   http.MethodPost,
+		path:     "/authenticate",
+		id:       "authenticate",
+		tag:      "Registration",
+		summary:  "Sign up or log in with a phone number; an OTP is sent to it by SMS.",
+		request:  controllers.RegistrationRequest{},
+		response: controllers.RegistrationResponse{},
+		errors: []*response.Error{
+			response.ErrInvalidRequest, response.ErrPhoneInvalid, response.ErrPhoneUndeliverable,
+			response.ErrPhoneVoip, response.ErrProviderUnavailable, response.ErrInternal,
+		},
+		invalid:    map[string]*response.Error{"PhoneNumber": response.ErrPhoneInvalid},
+		idempotent: true,
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/otp/verify",
+		id:       "verifyOTP",
+		tag:      "Verification",
+		summary:  "Verify the OTP sent to the user and create a session.",
+		request:  controllers.VerifyCodeRequest{},
+		response: controllers.VerifyCodeResponse{},
+		errors: []*response.Error{
+			response.ErrInvalidRequest, response.ErrOTPRequired, response.ErrUserIDInvalid, response.ErrUserNotFound,
+			response.ErrOTPInvalid, response.ErrOTPExpired, response.ErrInternal,
+		},
+		invalid: map[string]*response.Error{"Code": response.ErrOTPRequired, "UserID": response.ErrUserIDInvalid},
+	},
+	{
+		method:   http.MethodPost,
+		path:     "/otp/send",
+		id:       "resendOTP",
+		tag:      "Verification",
+		summary:  "Send a new OTP to a registered phone number.",
+		request:  controllers.ResendCodeRequest{},
+		response: controllers.ResendCodeResponse{},
+		errors: []*response.Error{
+			response.ErrInvalidRequest, response.ErrPhoneInvalid, response.ErrSMSFailed, response.ErrInternal,
+		},
+		invalid:    map[string]*response.Error{"PhoneNumber": response.ErrPhoneInvalid},
+		idempotent: true,
+	},
+	{
+		method:   http.MethodGet,
+		path:     "/profile",
+		id:       "getProfile",
+		tag:      "Profile",
+		summary:  "Get the profile of a user.",
+		query:    controllers.ProfileRequest{},
+		response: controllers.ProfileResponse{},
+		errors: []*response.Error{
+			response.ErrUserIDInvalid, response.ErrUserNotFound, response.ErrInternal,
+		},
+		invalid: map[string]*response.Error{"UserID": response.ErrUserIDInvalid},
+	},
+}
+
+// Spec returns the OpenAPI document of the public API served under each of the
+// given path prefixes, e.g. "/api/v1/user". The first prefix is the preferred one.
+func Spec(servers ...string) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "we-credit API",
+			Description: "Phone number registration, OTP verification and user profiles.",
+			Version:     "1.0.0",
+		},
+		Paths:      openapi3.NewPaths(),
+		Components: &openapi3.Components{Schemas: openapi3.Schemas{}},
+	}
+	for _, server := range servers {
+		doc.Servers = append(doc.Servers, &openapi3.Server{URL: server})
+	}
+
+	for _, op := range operations {
+		pathItem := doc.Paths.Value(op.path)
+		if pathItem == nil {
+			pathItem = &openapi3.PathItem{}
+			doc.Paths.Set(op.path, pathItem)
+		}
+		pathItem.SetOperation(op.method, op.build(doc))
+	}
+
+	err := doc.Validate(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Spec: generated document is invalid -> %w", err)
+	}
+	return doc, nil
+}
+
+// build returns the OpenAPI operation of op, adding its body schemas to the components of doc.
+func (op operation) build(doc *openapi3.T) *openapi3.Operation {
+	result := openapi3.NewOperation()
+	// without the default response AddResponse starts with, so that response
+	// validation catches the statuses the handlers are not documented to answer
+	result.Responses = openapi3.NewResponsesWithCapacity(0)
+	result.OperationID = op.id
+	result.Summary = op.summary
+	result.Tags = []string{op.tag}
+
+	if op.request != nil {
+		t := reflect.TypeOf(op.request)
+		// gin's ShouldBind accepts both encodings, picking the binding from the Content-Type.
+		result.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).WithContent(openapi3.Content{
+			"application/json":                  openapi3.NewMediaType().WithSchemaRef(component(doc, t.Name(), schemaFor(t, "json", false))),
+			"application/x-www-form-urlencoded": openapi3.NewMediaType().WithSchema(schemaFor(t, "form", false)),
+		})}
+	}
+	if op.query != nil {
+		t := reflect.TypeOf(op.query)
+		for _, field := range fields(t, "form") {
+			schema := schemaFor(field.Type, "form", false)
+			constrain(schema, field.Tag.Get("binding"))
+			parameter := openapi3.NewQueryParameter(field.name).WithSchema(schema)
+			parameter.Required = field.required(false)
+			result.AddParameter(parameter)
+		}
+	}
+
+	errs := slices.Clone(op.errors)
+	if op.method != http.MethodGet {
+		// see security.CSRF
+		errs = append(errs, response.ErrCSRF)
+	}
+	ok := openapi3.NewResponse().WithDescription("OK")
+	if op.idempotent {
+		maxLength := uint64(255)
+		key := openapi3.NewHeaderParameter(idempotency.Header).WithSchema(&openapi3.Schema{Type: &openapi3.Types{openapi3.TypeString}, MinLength: 1, MaxLength: &maxLength})
+		key.Description = "Retries with the same key within the idempotency window get the first response back, without sending another SMS."
+		result.AddParameter(key)
+		ok.Headers = openapi3.Headers{idempotency.ReplayedHeader: &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+			Description: `"true" when the response is replayed from an earlier request with the same key.`,
+			Schema:      openapi3.NewStringSchema().NewRef(),
+		}}}}
+		errs = append(errs, response.ErrIdempotencyInvalid, response.ErrIdempotencyReused, response.ErrIdempotencyPending)
+	}
+
+	t := reflect.TypeOf(op.response)
+	result.AddResponse(http.StatusOK, ok.WithContent(openapi3.NewContentWithJSONSchemaRef(component(doc, t.Name(), schemaFor(t, "json", true)))))
+
+	for _, status := range statuses(errs) {
+		result.AddResponse(status, errorResponse(errs, status))
+	}
+	return result
+}
+
+// component adds schema to the components of doc under name and returns a reference to it.
+func component(doc *openapi3.T, name string, schema *openapi3.Schema) *openapi3.SchemaRef {
+	doc.Components.Schemas[name] = openapi3.NewSchemaRef("", schema)
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, schema)
+}
+
+// statuses returns the distinct HTTP statuses of errs in increasing order.
+func statuses(errs []*response.Error) []int {
+	seen := map[int]bool{}
+	var result []int
+	for _, err := range errs {
+		if !seen[err.Status] {
+			seen[err.Status] = true
+			result = append(result, err.Status)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// errorResponse returns the response answered with status, listing the codes of errs that share it.
+func errorResponse(errs []*response.Error, status int) *openapi3.Response {
+	schema := schemaFor(reflect.TypeOf(response.ErrorBody{}), "json", true)
+	description := http.StatusText(status) + ":"
+	for _, err := range errs {
+		if err.Status != status {
+			continue
+		}
+		code := schema.Properties["code"].Value
+		if !slices.Contains(code.Enum, any(string(err.Code))) {
+			code.Enum = append(code.Enum, string(err.Code))
+		}
+		description += " " + string(err.Code) + " (" + err.Message + ")"
+	}
+	return openapi3.NewResponse().
+		WithDescription(description).
+		WithContent(openapi3.NewContentWithJSONSchema(schema))
+}
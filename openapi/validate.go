@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"we-credit/config"
+	"we-credit/logging"
+	"we-credit/response"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+)
+
+var logger = logging.For("openapi")
+
+// Middleware validates the requests, and optionally the responses, of the
+// routes described by doc as configured by cfg. Requests to other routes,
+// e.g. the probes, are let through untouched.
+//
+// With cfg.Validation "log" invalid requests are only logged, with "enforce"
+// they are answered before reaching the handler, with the code the handler
+// would have answered, e.g. PHONE_INVALID, see operation.requestError. Invalid
+// responses are always only logged; response validation buffers every body,
+// so it is meant for development and CI rather than production.
+func Middleware(doc *openapi3.T, cfg config.OpenAPIConfig) (gin.HandlerFunc, error) {
+	if cfg.Validation == "off" && !cfg.ValidateResponses {
+		return func(c *gin.Context) { c.Next() }, nil
+	}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Middleware: failed to route the document -> %w", err)
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+
+		if cfg.Validation != "off" {
+			// the body is restored after validation, so the handler can still bind it
+			err = openapi3filter.ValidateRequest(ctx, input)
+			if err != nil {
+				logger.WarnContext(ctx, "Middleware: request does not match the OpenAPI document", "operation", route.Operation.OperationID, "error", err)
+				if cfg.Validation == "enforce" {
+					response.Fail(c, requestError(route.Operation.OperationID, err))
+					return
+				}
+			}
+		}
+		if !cfg.ValidateResponses {
+			c.Next()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 recorder.Status(),
+			Header:                 recorder.Header(),
+			Body:                   &nopCloser{&recorder.body},
+			// a status the document does not list is a mismatch too
+			Options: &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Middleware: response does not match the OpenAPI document", "operation", route.Operation.OperationID, "status", recorder.Status(), "error", err)
+		}
+	}, nil
+}
+
+// requestError returns the error the handler of the operation id answers for
+// the request validation failure err, so that clients see the same codes
+// whether or not the document is enforced.
+func requestError(id string, err error) *response.Error {
+	for _, op := range operations {
+		if op.id == id {
+			return op.requestError(err)
+		}
+	}
+	return response.ErrInvalidRequest.Wrap(err)
+}
+
+// requestError maps err to the error of the field that failed, using op.invalid.
+// A query parameter is mapped whatever the failure, as the handlers answer
+// ShouldBindQuery errors with the error of the query. A body property is not
+// mapped when it has the wrong type, as bindError answers a body that cannot be
+// parsed with ErrInvalidRequest.
+func (op operation) requestError(err error) *response.Error {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return response.ErrInvalidRequest.Wrap(err)
+	}
+	if requestErr.Parameter != nil && requestErr.Parameter.In == openapi3.ParameterInQuery && op.query != nil {
+		if apiErr := op.fieldError(op.query, requestErr.Parameter.Name, "form"); apiErr != nil {
+			return apiErr.Wrap(err)
+		}
+	}
+	var schemaErr *openapi3.SchemaError
+	if requestErr.RequestBody != nil && op.request != nil && errors.As(requestErr.Err, &schemaErr) && schemaErr.SchemaField != "type" {
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			if apiErr := op.fieldError(op.request, pointer[0], "json", "form"); apiErr != nil {
+				return apiErr.Wrap(err)
+			}
+		}
+	}
+	return response.ErrInvalidRequest.Wrap(err)
+}
+
+// fieldError returns the error of op.invalid for the field of v named name under one of tagKeys, or nil.
+func (op operation) fieldError(v any, name string, tagKeys ...string) *response.Error {
+	for _, tagKey := range tagKeys {
+		for _, field := range fields(reflect.TypeOf(v), tagKey) {
+			if field.name == name {
+				return op.invalid[field.Name]
+			}
+		}
+	}
+	return nil
+}
+
+// bodyRecorder keeps a copy of the response body for response validation.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// nopCloser turns the recorded body into the io.ReadCloser ValidateResponse reads.
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// CheckRoutes returns an error listing the operations of doc that routes does not
+// serve under every server of doc, and the routes under those servers that doc does
+// not describe, so the server refuses to start with a document out of date.
+func CheckRoutes(doc *openapi3.T, routes gin.RoutesInfo) error {
+	served := map[string]bool{}
+	for _, route := range routes {
+		served[route.Method+" "+route.Path] = true
+	}
+
+	var problems []string
+	for _, server := range doc.Servers {
+		documented := map[string]bool{}
+		for path, pathItem := range doc.Paths.Map() {
+			for method := range pathItem.Operations() {
+				key := method + " " + server.URL + path
+				documented[key] = true
+				if !served[key] {
+					problems = append(problems, key+" is documented but not routed")
+				}
+			}
+		}
+		for key := range served {
+			_, path, _ := strings.Cut(key, " ")
+			if strings.HasPrefix(path, server.URL+"/") && !documented[key] {
+				problems = append(problems, key+" is routed but not documented")
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("CheckRoutes: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Handler serves doc as JSON.
+func Handler(doc *openapi3.T) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
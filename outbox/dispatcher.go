@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"time"
+	"we-credit/logging"
+	"we-credit/repository"
+)
+
+var logger = logging.For("outbox")
+
+// claimLease is how long a claimed SMS stays hidden from other dispatchers
+// before it is considered abandoned and retried.
+const claimLease = 30 * time.Second
+
+// SendFunc delivers a single SMS, e.g. service.SendMessage.
+type SendFunc func(ctx context.Context, phone, message, dialingCode string) error
+
+// Dispatcher delivers the SMS queued in the outbox by the registration flow.
+// Failed deliveries are retried with a growing delay until maxAttempts is reached.
+type Dispatcher struct {
+	repo         repository.OutboxRepository
+	send         SendFunc
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+}
+
+// NewDispatcher returns a Dispatcher polling repo every pollInterval and delivering up to batchSize SMS at a time with send.
+func NewDispatcher(repo repository.OutboxRepository, send SendFunc, pollInterval time.Duration, batchSize, maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		repo:         repo,
+		send:         send,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		maxAttempts:  maxAttempts,
+	}
+}
+
+// Run delivers queued SMS until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := d.dispatch(ctx)
+			if err != nil {
+				logger.ErrorContext(ctx, "Dispatcher.Run: failed to dispatch outbox", "error", err)
+			}
+		}
+	}
+}
+
+// Flush delivers every SMS currently due, batch after batch, until the outbox
+// is empty or ctx is done. It is meant to be called on shutdown.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	for {
+		sent, err := d.dispatch(ctx)
+		if err != nil || sent == 0 {
+			return err
+		}
+	}
+}
+
+// dispatch claims one batch of due SMS and delivers it, returning how many SMS were claimed.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	pending, err := d.repo.ClaimPendingSMS(ctx, d.batchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sms := range pending {
+		err := d.send(ctx, sms.Phone, sms.Message, sms.DialingCode)
+		if err == nil {
+			err = d.repo.MarkSMSSent(ctx, sms.ID)
+			if err != nil {
+				logger.ErrorContext(ctx, "Dispatcher: failed to mark sms as sent", "sms_id", sms.ID, "error", err)
+			}
+			continue
+		}
+
+		giveUp := sms.Attempts >= d.maxAttempts
+		// Back off quadratically: 1s, 4s, 9s, ... after each failed attempt.
+		retryAt := time.Now().Add(time.Duration(sms.Attempts*sms.Attempts) * time.Second)
+		logger.WarnContext(ctx, "Dispatcher: failed to send sms", "sms_id", sms.ID, "attempt", sms.Attempts, "error", err)
+		err = d.repo.MarkSMSFailed(ctx, sms.ID, err.Error(), retryAt, giveUp)
+		if err != nil {
+			logger.ErrorContext(ctx, "Dispatcher: failed to mark sms as failed", "sms_id", sms.ID, "error", err)
+		}
+	}
+	return len(pending), nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"we-credit/service"
+)
+
+// storedLocation is the JSON stored in the location columns. Its keys are part
+// of the schema, see database/006_structured_location.up.sql, and do not follow
+// the json tags of service.Location, which belong to the API. Names are in the
+// language preferred by the request the location was looked up for; codes do
+// not depend on it.
+type storedLocation struct {
+	ContinentCode   string              `json:"continent_code,omitempty"`
+	Continent       string              `json:"continent,omitempty"`
+	CountryCode     string              `json:"country_code,omitempty"`
+	Country         string              `json:"country,omitempty"`
+	SubdivisionCode string              `json:"subdivision_code,omitempty"`
+	Subdivision     string              `json:"subdivision,omitempty"`
+	Subdivisions    []storedSubdivision `json:"subdivisions,omitempty"`
+	City            string              `json:"city,omitempty"`
+	PostalCode      string              `json:"postal_code,omitempty"`
+	Latitude        float64             `json:"latitude,omitempty"`
+	Longitude       float64             `json:"longitude,omitempty"`
+	AccuracyRadius  uint16              `json:"accuracy_radius,omitempty"`
+	TimeZone        string              `json:"time_zone,omitempty"`
+}
+
+// storedSubdivision is an element of storedLocation.Subdivisions.
+type storedSubdivision struct {
+	Code string `json:"code,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// locationValue returns the value stored in a location column for location,
+// NULL when nothing is known about it.
+func locationValue(location service.Location) sql.NullString {
+	stored := storedLocation{
+		ContinentCode:   location.ContinentCode,
+		Continent:       location.Continent,
+		CountryCode:     location.CountryCode,
+		Country:         location.Country,
+		SubdivisionCode: location.StateCode,
+		Subdivision:     location.State,
+		City:            location.City,
+		PostalCode:      location.PostalCode,
+		Latitude:        location.Latitude,
+		Longitude:       location.Longitude,
+		AccuracyRadius:  location.AccuracyRadius,
+		TimeZone:        location.TimeZone,
+	}
+	for _, subdivision := range location.Subdivisions {
+		stored.Subdivisions = append(stored.Subdivisions, storedSubdivision(subdivision))
+	}
+	data, _ := json.Marshal(stored)
+	if string(data) == "{}" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// scanLocation decodes a location column read as value.
+func scanLocation(value sql.NullString) (service.Location, error) {
+	if !value.Valid {
+		return service.Location{}, nil
+	}
+	var stored storedLocation
+	err := json.Unmarshal([]byte(value.String), &stored)
+	if err != nil {
+		return service.Location{}, err
+	}
+	location := service.Location{
+		ContinentCode:  stored.ContinentCode,
+		Continent:      stored.Continent,
+		CountryCode:    stored.CountryCode,
+		Country:        stored.Country,
+		StateCode:      stored.SubdivisionCode,
+		State:          stored.Subdivision,
+		City:           stored.City,
+		PostalCode:     stored.PostalCode,
+		Latitude:       stored.Latitude,
+		Longitude:      stored.Longitude,
+		AccuracyRadius: stored.AccuracyRadius,
+		TimeZone:       stored.TimeZone,
+	}
+	for _, subdivision := range stored.Subdivisions {
+		location.Subdivisions = append(location.Subdivisions, service.Subdivision(subdivision))
+	}
+	return location, nil
+}
+
+// networkFromColumns rebuilds the network of a location from the asn, as_organization
+// and anonymizer_flags columns, the inverse of Network.AnonymizerFlags.
+func networkFromColumns(asn sql.NullInt64, asOrganization sql.NullString, anonymizerFlags []string) service.Network {
+	network := service.Network{
+		ASN:            uint(asn.Int64),
+		ASOrganization: asOrganization.String,
+	}
+	for _, flag := range anonymizerFlags {
+		switch flag {
+		case "anonymous":
+			network.IsAnonymous = true
+		case "anonymous_vpn":
+			network.IsAnonymousVPN = true
+		case "hosting_provider":
+			network.IsHostingProvider = true
+		case "public_proxy":
+			network.IsPublicProxy = true
+		case "residential_proxy":
+			network.IsResidentialProxy = true
+		case "tor_exit_node":
+			network.IsTorExitNode = true
+		}
+	}
+	return network
+}
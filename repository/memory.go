@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+	"we-credit/models"
+)
+
+// Memory implements every repository in memory. It is meant for unit tests
+// and local runs without a database; data is lost when the process exits.
+type Memory struct {
+	mu        sync.Mutex
+	nextID    int64
+	users     map[int64]models.User
+	phones    map[string]int64
+	sessions  []models.Session
+	countries map[string]models.CountryDetail
+	outbox    []memoryOutboxSMS
+	// idempotencyKeys are keyed by scope and key.
+	idempotencyKeys map[[2]string]memoryIdempotencyKey
+}
+
+// memoryIdempotencyKey is a row of the in-memory idempotency_key table.
+type memoryIdempotencyKey struct {
+	models.IdempotencyKey
+	createdAt time.Time
+}
+
+// memoryOutboxSMS is a row of the in-memory sms outbox.
+type memoryOutboxSMS struct {
+	models.OutboxSMS
+	status        string
+	lastError     string
+	nextAttemptAt time.Time
+}
+
+// NewMemory returns an empty in-memory repository.
+func NewMemory() *Memory {
+	return &Memory{
+		users:     make(map[int64]models.User),
+		phones:    make(map[string]int64),
+		countries: make(map[string]models.CountryDetail),
+
+		idempotencyKeys: make(map[[2]string]memoryIdempotencyKey),
+	}
+}
+
+// AddCountry registers a supported country, keyed by its ISO2 code.
+func (m *Memory) AddCountry(country models.CountryDetail) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.countries[country.CountryCode] = country
+}
+
+// Sessions returns a copy of every session created so far.
+func (m *Memory) Sessions() []models.Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.Session(nil), m.sessions...)
+}
+
+// upsertOTP mirrors the "ON CONFLICT (phone_number) DO UPDATE" statement used by Postgres:
+// a new phone number creates a user, an existing one only gets a fresh OTP.
+// It must be called with m.mu held.
+func (m *Memory) upsertOTP(user models.User) (models.User, string) {
+	otpValidUntil := time.Now().Add(time.Minute * 5)
+	if id, ok := m.phones[user.Phone]; ok {
+		existing := m.users[id]
+		existing.OTP = user.OTP
+		existing.OTPValidUntil = otpValidUntil
+		m.users[id] = existing
+		return existing, "update"
+	}
+
+	m.nextID++
+	user.ID = m.nextID
+	user.OTPValidUntil = otpValidUntil
+	user.IsPhoneVerified = false
+	user.CreatedAt = time.Now()
+	m.users[user.ID] = user
+	m.phones[user.Phone] = user.ID
+	return user, "insert"
+}
+
+// SaveNewUser see UserRepository.
+func (m *Memory) SaveNewUser(_ context.Context, user *models.User) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved, action := m.upsertOTP(*user)
+	user.ID = saved.ID
+	user.IsPhoneVerified = saved.IsPhoneVerified
+	return action, nil
+}
+
+// GetUserByID see UserRepository.
+func (m *Memory) GetUserByID(_ context.Context, userID int) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[int64(userID)]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+// GetUserProfile see UserRepository. Like the Postgres implementation it returns
+// an empty user and no error when the user does not exist.
+func (m *Memory) GetUserProfile(_ context.Context, userID int) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[int64(userID)]
+	if !ok {
+		return models.User{}, nil
+	}
+	return models.User{
+		ID:              user.ID,
+		IsPhoneVerified: user.IsPhoneVerified,
+		Phone:           user.Phone,
+		DialingCode:     user.DialingCode,
+		Location:        user.Location,
+		CreatedAt:       user.CreatedAt,
+	}, nil
+}
+
+// SaveOTP see OTPRepository.
+func (m *Memory) SaveOTP(_ context.Context, user models.User) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved, _ := m.upsertOTP(user)
+	return models.User{
+		ID:              saved.ID,
+		IsPhoneVerified: saved.IsPhoneVerified,
+	}, nil
+}
+
+// GetValidVerificationCode see OTPRepository.
+func (m *Memory) GetValidVerificationCode(_ context.Context, userID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if !time.Now().Before(user.OTPValidUntil) {
+		return "", ErrOTPExpired
+	}
+	return user.OTP, nil
+}
+
+// SetPhoneVerified see OTPRepository.
+func (m *Memory) SetPhoneVerified(_ context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+	user.IsPhoneVerified = true
+	m.users[userID] = user
+	return nil
+}
+
+// CreateNewSession see SessionRepository.
+func (m *Memory) CreateNewSession(_ context.Context, session models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+// GetDetailsOfSupportedCountryByCode see CountryRepository. Unknown or empty
+// country codes fall back to US, as in the Postgres implementation.
+func (m *Memory) GetDetailsOfSupportedCountryByCode(_ context.Context, countryCode string) (models.CountryDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	country, ok := m.countries[countryCode]
+	if !ok {
+		country, ok = m.countries["US"]
+	}
+	if !ok {
+		return models.CountryDetail{}, sql.ErrNoRows
+	}
+	return country, nil
+}
+
+// CheckCountryIsSupported see CountryRepository.
+func (m *Memory) CheckCountryIsSupported(_ context.Context, countryCode string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.countries[countryCode]
+	return ok, nil
+}
+
+// RegisterUser see RegistrationRepository.
+func (m *Memory) RegisterUser(_ context.Context, user *models.User, message func(models.User) string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved, action := m.upsertOTP(*user)
+	m.outbox = append(m.outbox, memoryOutboxSMS{
+		OutboxSMS: models.OutboxSMS{
+			ID:          int64(len(m.outbox) + 1),
+			UserID:      saved.ID,
+			Phone:       saved.Phone,
+			DialingCode: saved.DialingCode,
+			Message:     message(saved),
+		},
+		status:        "pending",
+		nextAttemptAt: time.Now(),
+	})
+	user.ID = saved.ID
+	user.IsPhoneVerified = saved.IsPhoneVerified
+	return action, nil
+}
+
+// ClaimPendingSMS see OutboxRepository.
+func (m *Memory) ClaimPendingSMS(_ context.Context, limit int, lease time.Duration) ([]models.OutboxSMS, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []models.OutboxSMS
+	now := time.Now()
+	for i := range m.outbox {
+		if len(pending) == limit {
+			break
+		}
+		sms := &m.outbox[i]
+		if sms.status != "pending" || sms.nextAttemptAt.After(now) {
+			continue
+		}
+		sms.Attempts++
+		sms.nextAttemptAt = now.Add(lease)
+		pending = append(pending, sms.OutboxSMS)
+	}
+	return pending, nil
+}
+
+// MarkSMSSent see OutboxRepository.
+func (m *Memory) MarkSMSSent(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.outbox {
+		if m.outbox[i].ID == id {
+			m.outbox[i].status = "sent"
+			m.outbox[i].Message = ""
+			m.outbox[i].lastError = ""
+		}
+	}
+	return nil
+}
+
+// MarkSMSFailed see OutboxRepository.
+func (m *Memory) MarkSMSFailed(_ context.Context, id int64, reason string, retryAt time.Time, giveUp bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.outbox {
+		if m.outbox[i].ID != id {
+			continue
+		}
+		m.outbox[i].status = "pending"
+		if giveUp {
+			m.outbox[i].status = "failed"
+			m.outbox[i].Message = ""
+		}
+		m.outbox[i].lastError = reason
+		m.outbox[i].nextAttemptAt = retryAt
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey see IdempotencyRepository.
+func (m *Memory) ClaimIdempotencyKey(_ context.Context, key models.IdempotencyKey, lease time.Duration) (models.IdempotencyKey, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	id := [2]string{key.Scope, key.Key}
+	if stored, ok := m.idempotencyKeys[id]; ok && !stored.ExpiresAt.Before(now) {
+		return stored.IdempotencyKey, false, nil
+	}
+	key.StatusCode, key.ContentType, key.Body = 0, "", nil
+	key.ExpiresAt = now.Add(lease)
+	m.idempotencyKeys[id] = memoryIdempotencyKey{IdempotencyKey: key, createdAt: now}
+	return key, true, nil
+}
+
+// CompleteIdempotencyKey see IdempotencyRepository.
+func (m *Memory) CompleteIdempotencyKey(_ context.Context, key models.IdempotencyKey, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{key.Scope, key.Key}
+	stored, ok := m.idempotencyKeys[id]
+	if !ok {
+		return nil
+	}
+	stored.StatusCode, stored.ContentType = key.StatusCode, key.ContentType
+	stored.Body = append([]byte(nil), key.Body...)
+	stored.ExpiresAt = stored.createdAt.Add(ttl)
+	m.idempotencyKeys[id] = stored
+	return nil
+}
+
+// ReleaseIdempotencyKey see IdempotencyRepository.
+func (m *Memory) ReleaseIdempotencyKey(_ context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotencyKeys, [2]string{scope, key})
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys see IdempotencyRepository.
+func (m *Memory) DeleteExpiredIdempotencyKeys(_ context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for id, stored := range m.idempotencyKeys {
+		if stored.ExpiresAt.Before(now) {
+			delete(m.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"we-credit/models"
+)
+
+// TestOutboxClearsDeliveredMessages makes sure the OTP carried by an SMS is only
+// kept until the SMS is sent or given up on.
+func TestOutboxClearsDeliveredMessages(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	message := func(user models.User) string { return user.OTP + " is your code" }
+	for _, phone := range []string{"4155550100", "4155550101", "4155550102"} {
+		_, err := m.RegisterUser(ctx, &models.User{Phone: phone, OTP: "1234"}, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := errors.Join(
+		m.MarkSMSSent(ctx, 1),
+		m.MarkSMSFailed(ctx, 2, "undelivered", time.Now(), false),
+		m.MarkSMSFailed(ctx, 3, "undelivered", time.Now(), true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"", "1234 is your code", ""} {
+		if got := m.outbox[i].Message; got != want {
+			t.Errorf("SMS %d (%s) message = %q, want %q", i+1, m.outbox[i].status, got, want)
+		}
+	}
+}
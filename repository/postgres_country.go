@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"we-credit/models"
+)
+
+// GetDetailsOfSupportedCountryByCode retrieves the details of a supported country by its code.
+// Parameters:
+// - countryCode: The country code (ISO2 or name) for which the details are to be retrieved.
+// Returns:
+// - CountryDetail: The details of the supported country.
+// - error: Any error encountered during the process.
+func (r *Postgres) GetDetailsOfSupportedCountryByCode(ctx context.Context, countryCode string) (models.CountryDetail, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		sc     models.CountryDetail
+		exists bool
+		err    error
+	)
+	exists, err = r.CheckCountryIsSupported(ctx, countryCode)
+	if err != nil {
+		logger.ErrorContext(ctx, "GetDetailsOfSupportedCountry: failed while checking if country code exists", "error", err)
+		return models.CountryDetail{}, err
+	}
+	// If country code is not provided, set it to US
+	if !exists || len(countryCode) == 0 {
+		countryCode = "US"
+	}
+
+	// countryCode is always an ISO2 code at this point, names are not looked up.
+	query := `
+		SELECT
+			id,
+			name,
+			iso2,
+			phonecode
+		FROM
+			countries
+		WHERE
+			iso2 = $1`
+
+	err = r.readRow(ctx, query, []any{countryCode},
+		&sc.CountryID,
+		&sc.CountryName,
+		&sc.CountryCode,
+		&sc.CountryPhoneCode,
+	)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "GetDetailsOfSupportedCountry failed while executing the query", "error", err)
+		return models.CountryDetail{}, err
+	}
+	// Return the retrieved data as a SupportedCountry struct as sc
+	return sc, nil
+}
+
+// CheckCountryIsSupported checks if a country is supported based on the given country code or name.
+// Parameters:
+// - countryCode: The country code (ISO2 or name) to check for support.
+// Returns:
+// - bool: True if the country is supported, false otherwise.
+// - error: Any error encountered during the process.s
+func (r *Postgres) CheckCountryIsSupported(ctx context.Context, countryCode string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var isSupported sql.NullBool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM countries
+			WHERE iso2 = $1
+		)`
+
+	err := r.readRow(ctx, query, []any{countryCode}, &isSupported)
+	if err != nil {
+		logger.ErrorContext(ctx, "CheckCountryIsSupported: Failed while querying", "error", err)
+		return false, err
+	}
+
+	return isSupported.Bool, nil
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"we-credit/database"
+)
+
+// Ping checks that the primary database is reachable.
+func (r *Postgres) Ping(ctx context.Context) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.db.PingContext(ctx)
+}
+
+// CheckMigrations verifies that the schema has every migration shipped with this
+// build applied and that the last migration run did not stop half way.
+func (r *Postgres) CheckMigrations(ctx context.Context) error {
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	var version int64
+	var dirty bool
+	err := r.queryRow(ctx, query).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("no migration has been applied")
+	}
+	if err != nil {
+		return fmt.Errorf("reading schema_migrations: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d failed and left the schema dirty", version)
+	}
+	if latest := database.LatestVersion(); version < latest {
+		return fmt.Errorf("schema is at version %d, this build expects %d", version, latest)
+	}
+	return nil
+}
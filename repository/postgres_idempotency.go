@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"we-credit/models"
+)
+
+// ClaimIdempotencyKey reserves key for the request handling it until lease elapses.
+// Keys that have expired, including claims whose request never completed, are claimed again.
+// Parameters:
+// - key: the scope, key and request hash to claim.
+// - lease: how long the claim is held before the key is stored with its response.
+// Returns:
+// - models.IdempotencyKey: the stored key when it is held by another request, otherwise key.
+// - bool: true when the key was claimed by this call.
+// - error: Any error encountered during the process.
+func (r *Postgres) ClaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey, lease time.Duration) (models.IdempotencyKey, bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO idempotency_key (scope, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4::float8 * INTERVAL '1 second')
+		ON CONFLICT (scope, key)
+		DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = NULL,
+			content_type = NULL,
+			response_body = NULL,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_key.expires_at < NOW()
+		RETURNING expires_at`
+
+	err := r.queryRow(ctx, query, key.Scope, key.Key, key.RequestHash, lease.Seconds()).Scan(&key.ExpiresAt)
+	if err == nil {
+		return key, true, nil
+	}
+	if err != sql.ErrNoRows {
+		logger.ErrorContext(ctx, "ClaimIdempotencyKey: failed to claim key", "error", err)
+		return key, false, err
+	}
+
+	query = `
+		SELECT request_hash, status_code, content_type, response_body, expires_at
+		FROM idempotency_key
+		WHERE scope = $1 AND key = $2`
+
+	var (
+		stored      models.IdempotencyKey
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+	)
+	stored.Scope, stored.Key = key.Scope, key.Key
+	err = r.queryRow(ctx, query, key.Scope, key.Key).Scan(&stored.RequestHash, &statusCode, &contentType, &stored.Body, &stored.ExpiresAt)
+	if err == sql.ErrNoRows {
+		// released between the two queries, the caller treats it as still in progress
+		return stored, false, nil
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "ClaimIdempotencyKey: failed to read the stored key", "error", err)
+		return key, false, err
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	stored.ContentType = contentType.String
+	return stored, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed key,
+// to be replayed to its retries for ttl from the first request.
+func (r *Postgres) CompleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey, ttl time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE idempotency_key
+		SET
+			status_code = $3,
+			content_type = $4,
+			response_body = $5,
+			expires_at = created_at + $6::float8 * INTERVAL '1 second'
+		WHERE scope = $1 AND key = $2`
+
+	_, err := r.exec(ctx, query, key.Scope, key.Key, key.StatusCode, key.ContentType, key.Body, ttl.Seconds())
+	if err != nil {
+		logger.ErrorContext(ctx, "CompleteIdempotencyKey: failed to store the response", "error", err)
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key, so that a retry is handled as a new request.
+func (r *Postgres) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_key WHERE scope = $1 AND key = $2`
+
+	_, err := r.exec(ctx, query, scope, key)
+	if err != nil {
+		logger.ErrorContext(ctx, "ReleaseIdempotencyKey: failed to delete key", "error", err)
+	}
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys deletes the keys past their window and returns how many were deleted.
+func (r *Postgres) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_key WHERE expires_at < NOW()`
+
+	result, err := r.exec(ctx, query)
+	if err != nil {
+		logger.ErrorContext(ctx, "DeleteExpiredIdempotencyKeys: failed to delete expired keys", "error", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
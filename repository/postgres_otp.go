@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"we-credit/models"
+)
+
+// GetValidVerificationCode
+// input : userID
+// Output: OTP code, error
+// Desc  : This function will return the OTP code, and it will also check current time is less than the expire time of OTP.
+func (r *Postgres) GetValidVerificationCode(ctx context.Context, userID int64) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var OTP sql.NullString
+	var OTP_expire sql.NullTime
+
+	err := r.queryRow(ctx, "SELECT otp, otp_valid_until FROM public.user WHERE id=$1", userID).Scan(&OTP, &OTP_expire)
+	if err != nil {
+		logger.ErrorContext(ctx, "GetValidVerificationCode: Failed while querying and scanning the row", "error", err)
+		return "", err
+	}
+
+	// Checking the OTP expire
+	expireDate := (OTP_expire).Time.Format("2006-01-02 15:04:05")
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+
+	l_expireDate, _ := time.Parse("2006-01-02 15:04:05", expireDate)
+	l_currentTime, _ := time.Parse("2006-01-02 15:04:05", currentTime)
+
+	result := l_currentTime.Before(l_expireDate)
+
+	if !result {
+		return "", ErrOTPExpired
+	}
+
+	return (OTP).String, nil
+}
+
+// SetPhoneVerified
+// input : studentID, verification flag
+// Output: error
+// Desc  : This function will set the phone verification flag as true/false.
+func (r *Postgres) SetPhoneVerified(ctx context.Context, userID int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+				UPDATE
+					public.user
+				SET
+					phone_verified = true
+				WHERE id=$1`
+
+	_, err := r.exec(ctx, query, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "SetPhoneVerified: failed while execute the query", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// SaveOTP
+// input : phone number, OTP,user ip , location
+// Output: student struct or error
+// Desc  : This function will save the OTP and expire time of OTP in database.
+// A new user gets the same columns as from SaveNewUser, so that its dialing code
+// and network do not depend on whether it registered or asked for a resend first.
+func (r *Postgres) SaveOTP(ctx context.Context, user models.User) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		user_id       int
+		phoneVerified bool
+		action        string
+	)
+	otpValidUntil := time.Now().Add(time.Minute * 5)
+	// Set phone_otp_expire time to 24 hrs from date of student generated.
+
+	err := r.queryRow(ctx, saveNewUserQuery, saveNewUserArgs(&user, otpValidUntil)...).Scan(&user_id, &phoneVerified, &action)
+	if err != nil {
+		logger.ErrorContext(ctx, "SaveOTP: failed while execute the query for saving otp in database", "error", err)
+		return models.User{}, err
+	}
+	return models.User{
+		ID:              int64(user_id),
+		IsPhoneVerified: phoneVerified,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"we-credit/models"
+	"we-credit/repository/stubdb"
+	"we-credit/service"
+)
+
+// TestSaveOTPSavesTheSameColumnsAsSaveNewUser makes sure a user created by a
+// resend gets the dialing code and network a registration would have saved.
+func TestSaveOTPSavesTheSameColumnsAsSaveNewUser(t *testing.T) {
+	connector := &stubdb.Connector{
+		Record: true,
+		Answer: func(stubdb.Query) (stubdb.Rows, error) {
+			return stubdb.Rows{
+				Columns: []string{"id", "phone_verified", "action"},
+				Values:  [][]driver.Value{{int64(7), false, "insert"}},
+			}, nil
+		},
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	repo := NewPostgres(db, time.Second)
+
+	user := models.User{
+		Phone:       "4155550100",
+		DialingCode: "+61",
+		UserIP:      "203.0.113.7",
+		OTP:         "1234",
+		Location: service.Location{
+			CountryCode: "AU",
+			City:        "Sydney",
+			Network:     service.Network{ASN: 64500, ASOrganization: "Example Networks", IsAnonymousVPN: true},
+		},
+	}
+	saved, err := repo.SaveOTP(context.Background(), user)
+	if err != nil || saved.ID != 7 {
+		t.Fatalf("SaveOTP = %+v, %v, want user 7", saved, err)
+	}
+	registered := user
+	_, err = repo.SaveNewUser(context.Background(), &registered)
+	if err != nil {
+		t.Fatalf("SaveNewUser: %v", err)
+	}
+
+	queries := connector.Queries()
+	if len(queries) != 2 {
+		t.Fatalf("queries = %+v, want one per call", queries)
+	}
+	resend, registration := queries[0], queries[1]
+	if resend.SQL != registration.SQL {
+		t.Errorf("SaveOTP sent\n%s\nwant the query of SaveNewUser\n%s", resend.SQL, registration.SQL)
+	}
+	// the OTP expiry is computed on each call
+	resend.Args[2], registration.Args[2] = nil, nil
+	if !reflect.DeepEqual(resend.Args, registration.Args) {
+		t.Errorf("SaveOTP args = %v, want the args of SaveNewUser %v", resend.Args, registration.Args)
+	}
+}
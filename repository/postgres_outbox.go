@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"we-credit/models"
+)
+
+// RegisterUser saves the user with its OTP challenge and enqueues the verification SMS in one transaction.
+// Parameters:
+// - user: the user to save; its ID and IsPhoneVerified are set from the saved row.
+// - message: builds the SMS text from the saved user (the text differs for sign up and log in).
+// Returns:
+// - string: "insert" for a new user, "update" for an existing phone number.
+// - error: Any error encountered during the process, in which case nothing is saved.
+func (r *Postgres) RegisterUser(ctx context.Context, user *models.User, message func(models.User) string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.ErrorContext(ctx, "RegisterUser: failed to begin transaction", "error", err)
+		return "", err
+	}
+	// Rollback is a no-op once the transaction is committed.
+	defer tx.Rollback()
+
+	var (
+		userID        int64
+		phoneVerified bool
+		action        string
+	)
+	otpValidUntil := time.Now().Add(time.Minute * 5)
+
+	err = r.txQueryRow(ctx, tx, saveNewUserQuery, saveNewUserArgs(user, otpValidUntil)...).Scan(&userID, &phoneVerified, &action)
+	if err != nil {
+		logger.ErrorContext(ctx, "RegisterUser: failed while saving user and otp", "error", err)
+		return "", err
+	}
+
+	saved := *user
+	saved.ID = userID
+	saved.IsPhoneVerified = phoneVerified
+
+	query := `
+		INSERT INTO sms_outbox (user_id, phone_number, dialing_code, message)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = r.txExec(ctx, tx, query, saved.ID, saved.Phone, saved.DialingCode, message(saved))
+	if err != nil {
+		logger.ErrorContext(ctx, "RegisterUser: failed while enqueueing verification sms", "error", err)
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.ErrorContext(ctx, "RegisterUser: failed to commit transaction", "error", err)
+		return "", err
+	}
+
+	user.ID = saved.ID
+	user.IsPhoneVerified = saved.IsPhoneVerified
+	return action, nil
+}
+
+// ClaimPendingSMS returns up to limit SMS that are due for delivery.
+// Claimed rows get their attempt counted and are pushed lease into the future,
+// so they are retried automatically if this instance dies before marking them.
+func (r *Postgres) ClaimPendingSMS(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxSMS, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sms_outbox
+		SET
+			attempts = attempts + 1,
+			next_attempt_at = NOW() + $2::float8 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id
+			FROM sms_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, phone_number, COALESCE(dialing_code, ''), message, attempts`
+
+	rows, err := r.query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		logger.ErrorContext(ctx, "ClaimPendingSMS: failed while executing query", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []models.OutboxSMS
+	for rows.Next() {
+		var sms models.OutboxSMS
+		err = rows.Scan(&sms.ID, &sms.UserID, &sms.Phone, &sms.DialingCode, &sms.Message, &sms.Attempts)
+		if err != nil {
+			logger.ErrorContext(ctx, "ClaimPendingSMS: failed while scanning row", "error", err)
+			return nil, err
+		}
+		pending = append(pending, sms)
+	}
+	return pending, rows.Err()
+}
+
+// MarkSMSSent marks the SMS as delivered so it is never sent again. Its message,
+// which carries the OTP, is cleared so that codes are not kept at rest.
+func (r *Postgres) MarkSMSSent(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sms_outbox
+		SET
+			status = 'sent',
+			message = '',
+			sent_at = NOW(),
+			last_error = NULL
+		WHERE id = $1`
+
+	_, err := r.exec(ctx, query, id)
+	if err != nil {
+		logger.ErrorContext(ctx, "MarkSMSSent: failed while executing query", "error", err)
+		return err
+	}
+	return nil
+}
+
+// MarkSMSFailed records a failed delivery and schedules the next attempt, or gives
+// up on the SMS, clearing its message as MarkSMSSent does.
+func (r *Postgres) MarkSMSFailed(ctx context.Context, id int64, reason string, retryAt time.Time, giveUp bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE sms_outbox
+		SET
+			status = CASE WHEN $4::boolean THEN 'failed' ELSE 'pending' END,
+			message = CASE WHEN $4::boolean THEN '' ELSE message END,
+			last_error = $2,
+			next_attempt_at = $3
+		WHERE id = $1`
+
+	_, err := r.exec(ctx, query, id, reason, retryAt, giveUp)
+	if err != nil {
+		logger.ErrorContext(ctx, "MarkSMSFailed: failed while executing query", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"we-credit/models"
+
+	"github.com/lib/pq"
+)
+
+// CreateNewSession function to insert user session into table
+// Parameter -
+// session : the session to persist, holding the user id, JWT token, validity,
+// browser, device, ip address with the chain of proxies it was resolved from, location and network of the user.
+// Return -
+// success or error
+func (r *Postgres) CreateNewSession(ctx context.Context, session models.Session) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	sqlInsert := `
+	INSERT INTO
+		user_auth (
+			user_id,
+			jwt_token,
+			valid_until,
+			browser,
+			ip,
+			location,
+			device_info,
+			ip_chain,
+			asn,
+			as_organization,
+			anonymizer_flags,
+			created_at
+		)
+	VALUES
+		($1, $2,$3,$4,$5,$6::jsonb,$7,$8,NULLIF($9, 0),NULLIF($10, ''),$11,NOW())
+	RETURNING id`
+
+	_, err := r.exec(ctx, sqlInsert, session.UserID, session.Token, session.ValidUntil, session.Browser, session.IP, locationValue(session.Location), session.Device, pq.Array(session.IPChain),
+		int64(session.Location.ASN), session.Location.ASOrganization, pq.Array(session.Location.AnonymizerFlags()))
+	if err != nil {
+		logger.ErrorContext(ctx, "CreateNewSession: failed while executing query", "error", err)
+		return err
+	}
+	return nil
+}
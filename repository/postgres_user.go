@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"we-credit/models"
+
+	"github.com/lib/pq"
+)
+
+// saveNewUserQuery inserts a user or refreshes the OTP of an existing phone number.
+// It is shared by SaveNewUser, SaveOTP and RegisterUser.
+const saveNewUserQuery = `
+			INSERT INTO public.user (phone_number, otp, otp_valid_until, location, ip, dialing_code, asn, as_organization, anonymizer_flags)
+			VALUES ($1, $2, $3, $4::jsonb, $5, $6, NULLIF($7, 0), NULLIF($8, ''), $9)
+			ON CONFLICT (phone_number)
+			DO UPDATE SET
+			otp = $2,
+			otp_valid_until = $3
+			RETURNING id, phone_verified,
+			 CASE WHEN xmax = 0 THEN 'insert' ELSE 'update' END AS action`
+
+// saveNewUserArgs returns the arguments of saveNewUserQuery for user.
+func saveNewUserArgs(user *models.User, otpValidUntil time.Time) []any {
+	network := user.Location.Network
+	return []any{user.Phone, user.OTP, otpValidUntil, locationValue(user.Location), user.UserIP, user.DialingCode,
+		int64(network.ASN), network.ASOrganization, pq.Array(network.AnonymizerFlags())}
+}
+
+// SaveNewUser inserts a new user with a fresh OTP, or refreshes the OTP when the
+// phone number is already registered. It sets user.ID and user.IsPhoneVerified
+// and returns "insert" or "update" depending on which happened.
+func (r *Postgres) SaveNewUser(ctx context.Context, user *models.User) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		user_id       int
+		phoneVerified bool
+		action        string
+	)
+	otpValidUntil := time.Now().Add(time.Minute * 5)
+	// Set phone_otp_expire time to 24 hrs from date of user generated.
+
+	err := r.queryRow(ctx, saveNewUserQuery, saveNewUserArgs(user, otpValidUntil)...).Scan(&user_id, &phoneVerified, &action)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "SaveOTP: failed while execute the query for saving otp in database", "error", err)
+		return "", err
+	}
+
+	user.ID = int64(user_id)
+	user.IsPhoneVerified = phoneVerified
+
+	return action, nil
+}
+
+// GetUserByID retrieves a user record from the database by user ID.
+// Parameters:
+// - userID: The ID of the user to retrieve.
+// Returns:
+// - user: The user record retrieved from the database.
+// - error: Any error encountered during the process.
+func (r *Postgres) GetUserByID(ctx context.Context, userID int) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT
+			id,
+			phone_number,
+			phone_verified,
+			otp,
+			location
+		FROM
+			public.user
+		WHERE
+			id = $1`
+
+	var (
+		ID              sql.NullInt64
+		phone           sql.NullString
+		isPhoneVerified sql.NullBool
+		otp             sql.NullString
+		location        sql.NullString
+		user            models.User
+	)
+
+	err := r.queryRow(ctx, query, userID).Scan(
+		&ID,
+		&phone,
+		&isPhoneVerified,
+		&otp,
+		&location,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.WarnContext(ctx, "GetUserByID: user doesnt exist", "error", err)
+		}
+	}
+
+	locStruct, locErr := scanLocation(location)
+	if locErr != nil {
+		logger.ErrorContext(ctx, "GetUserByID: failed to decode the location", "error", locErr)
+	}
+
+	user = models.User{
+		ID:              ID.Int64,
+		Phone:           phone.String,
+		IsPhoneVerified: isPhoneVerified.Bool,
+		OTP:             otp.String,
+		Location:        locStruct,
+	}
+
+	return user, err
+}
+
+// GetuserProfile retrieves the profile details of a user from the database based on the provided user ID.
+// It returns a user struct containing the user's information or an error if the operation fails.
+//
+// Parameters:
+//   - userID (int): The unique identifier for the user whose profile is to be retrieved.
+//
+// Returns:
+//   - user: A struct containing the user's profile details such as name, grade, parent email, picture URL, and school ID.
+//   - error: An error object if there is any failure during database connection or query execution.
+func (r *Postgres) GetUserProfile(ctx context.Context, userID int) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var userDetails models.User
+	var (
+		isPhoneVerified sql.NullBool
+		phoneNumber     sql.NullString
+		dialingCode     sql.NullString
+		location        sql.NullString
+		asn             sql.NullInt64
+		asOrganization  sql.NullString
+		anonymizerFlags []string
+		createdAt       sql.NullTime
+	)
+	query := `
+		SELECT                                     
+    			u.phone_verified,
+    			u.phone_number,
+    			u.dialing_code,
+    			u.location,
+    			u.asn,
+    			u.as_organization,
+    			u.anonymizer_flags,
+				u.created_at
+		FROM 
+		    public.user AS u 
+		WHERE 
+   			 u.id = $1
+`
+
+	// The profile is read-only, so it may be served by the read replica.
+	err := r.readRow(ctx, query, []any{userID},
+		&isPhoneVerified,
+		&phoneNumber,
+		&dialingCode,
+		&location,
+		&asn,
+		&asOrganization,
+		pq.Array(&anonymizerFlags),
+		&createdAt,
+	)
+	if err == sql.ErrNoRows {
+		return userDetails, nil
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "GetUserProfile: Failed while execute the query", "error", err)
+		return userDetails, err
+	}
+	locStruct, err := scanLocation(location)
+	if err != nil {
+		logger.ErrorContext(ctx, "GetUserProfile: failed to decode the location", "error", err)
+		return userDetails, err
+	}
+	locStruct.Network = networkFromColumns(asn, asOrganization, anonymizerFlags)
+	// Create a map to store the session details.
+	userDetails = models.User{
+		ID:              int64(userID),
+		IsPhoneVerified: isPhoneVerified.Bool,
+		Phone:           phoneNumber.String,
+		DialingCode:     dialingCode.String,
+		Location:        locStruct,
+		CreatedAt:       createdAt.Time,
+	}
+	return userDetails, nil
+}
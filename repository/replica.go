@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// replica is a read replica that read-only queries are routed to while it is
+// reachable and its replication lag stays below maxLag.
+type replica struct {
+	db      *sql.DB
+	maxLag  time.Duration
+	healthy atomic.Bool
+}
+
+// UseReplica routes read-only queries to db. It must be called before the
+// repository is used. The replica starts out healthy; MonitorReplica keeps its
+// health up to date. Writes always go to the primary.
+func (r *Postgres) UseReplica(db *sql.DB, maxLag time.Duration) {
+	rep := &replica{db: db, maxLag: maxLag}
+	rep.healthy.Store(true)
+	r.replica = rep
+}
+
+// MonitorReplica checks the replica every interval until ctx is cancelled. A replica
+// that cannot be reached, or lags more than maxLag behind the primary, is skipped
+// and reads fall back to the primary until a later check finds it healthy again.
+func (r *Postgres) MonitorReplica(ctx context.Context, interval time.Duration) {
+	if r.replica == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.checkReplica(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReplica measures the replication lag of the replica and updates its health.
+func (r *Postgres) checkReplica(ctx context.Context) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	// The position of the primary is read first, so that a replica that has
+	// replayed up to it was caught up when it was checked. The replica's own
+	// received position cannot tell: it stops moving when its WAL receiver
+	// disconnects, while the primary carries on.
+	var primaryLSN sql.NullString
+	err := r.db.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&primaryLSN)
+	if err != nil {
+		logger.WarnContext(ctx, "checkReplica: failed to read the WAL position of the primary, measuring the lag by the last replayed transaction", "error", err)
+	}
+
+	query := `
+		SELECT
+			pg_is_in_recovery(),
+			pg_wal_lsn_diff($1::pg_lsn, pg_last_wal_replay_lsn()),
+			COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)`
+
+	var (
+		inRecovery   bool
+		pendingBytes sql.NullFloat64
+		replayAge    float64
+	)
+	err = r.replica.db.QueryRowContext(ctx, query, primaryLSN).Scan(&inRecovery, &pendingBytes, &replayAge)
+	if err != nil {
+		r.setReplicaHealthy(false, "replica is unreachable: "+err.Error())
+		return
+	}
+	lag := replicationLag(inRecovery, pendingBytes, replayAge)
+	if r.replica.maxLag > 0 && lag > r.replica.maxLag {
+		r.setReplicaHealthy(false, "replica lags "+lag.String()+" behind the primary")
+		return
+	}
+	r.setReplicaHealthy(true, "replica is healthy again")
+}
+
+// replicationLag returns how far a replica is behind the primary. A server that
+// is not in recovery (e.g. the replica setting points at the primary itself) has
+// no lag, nor has a replica that replayed all the WAL the primary had written,
+// pendingBytes <= 0: the time since its last replayed transaction only grows while
+// the primary is idle. Otherwise, or when the position of the primary is unknown,
+// the lag is replayAge, the seconds since the last replayed transaction.
+func replicationLag(inRecovery bool, pendingBytes sql.NullFloat64, replayAge float64) time.Duration {
+	if !inRecovery || pendingBytes.Valid && pendingBytes.Float64 <= 0 {
+		return 0
+	}
+	return time.Duration(replayAge * float64(time.Second))
+}
+
+// setReplicaHealthy records the replica health and logs every change.
+func (r *Postgres) setReplicaHealthy(healthy bool, reason string) {
+	if r.replica.healthy.Swap(healthy) == healthy {
+		return
+	}
+	target := "primary"
+	if healthy {
+		target = "replica"
+	}
+	logger.Warn("Postgres: routing reads to the "+target, "reason", reason)
+}
+
+// reader returns the pool read-only queries should use.
+func (r *Postgres) reader() *sql.DB {
+	if r.replica != nil && r.replica.healthy.Load() {
+		return r.replica.db
+	}
+	return r.db
+}
+
+// readRow runs a read-only query on the replica when it is healthy and scans
+// the single resulting row into dest. If the replica fails for any reason other
+// than the row not existing, it is marked unhealthy and the query is retried on the primary.
+func (r *Postgres) readRow(ctx context.Context, query string, args []any, dest ...any) error {
+	db := r.reader()
+	err := r.queryRowOn(ctx, db, query, args...).Scan(dest...)
+	if err == nil || errors.Is(err, sql.ErrNoRows) || db == r.db || ctx.Err() != nil {
+		return err
+	}
+
+	r.setReplicaHealthy(false, "replica query failed: "+err.Error())
+	return r.queryRowOn(ctx, r.db, query, args...).Scan(dest...)
+}
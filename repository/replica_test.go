@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"we-credit/repository/stubdb"
+)
+
+func TestCheckReplica(t *testing.T) {
+	tests := []struct {
+		name string
+		// primaryLSN is nil when the primary cannot be reached.
+		primaryLSN   driver.Value
+		inRecovery   bool
+		pendingBytes driver.Value
+		replayAge    float64
+		healthy      bool
+	}{
+		{"caught up", "0/5000000", true, "0", 0.5, true},
+		{"idle primary", "0/5000000", true, "0", 600, true},
+		{"disconnected receiver", "0/5000000", true, "1048576", 600, false},
+		{"replaying", "0/5000000", true, "4096", 1, true},
+		{"primary itself", "0/5000000", false, nil, 0, true},
+		{"primary unreachable, recent replay", nil, true, nil, 1, true},
+		{"primary unreachable, old replay", nil, true, nil, 600, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			primary := &stubdb.Connector{Answer: func(stubdb.Query) (stubdb.Rows, error) {
+				if test.primaryLSN == nil {
+					return stubdb.Rows{}, errors.New("connection refused")
+				}
+				return stubdb.Rows{Columns: []string{"lsn"}, Values: [][]driver.Value{{test.primaryLSN}}}, nil
+			}}
+			replica := &stubdb.Connector{Record: true, Answer: func(stubdb.Query) (stubdb.Rows, error) {
+				return stubdb.Rows{
+					Columns: []string{"in_recovery", "pending", "replay_age"},
+					Values:  [][]driver.Value{{test.inRecovery, test.pendingBytes, test.replayAge}},
+				}, nil
+			}}
+			primaryDB, replicaDB := sql.OpenDB(primary), sql.OpenDB(replica)
+			defer primaryDB.Close()
+			defer replicaDB.Close()
+
+			repo := NewPostgres(primaryDB, 0)
+			repo.UseReplica(replicaDB, 10*time.Second)
+			repo.replica.healthy.Store(!test.healthy)
+			repo.checkReplica(context.Background())
+
+			if healthy := repo.replica.healthy.Load(); healthy != test.healthy {
+				t.Errorf("healthy = %v, want %v", healthy, test.healthy)
+			}
+			queries := replica.Queries()
+			if len(queries) != 1 || !strings.Contains(queries[0].SQL, "pg_last_wal_replay_lsn") {
+				t.Fatalf("replica queries = %+v", queries)
+			}
+			if got := queries[0].Args[0]; got != test.primaryLSN {
+				t.Errorf("the replica was compared with %v, want the position of the primary %v", got, test.primaryLSN)
+			}
+		})
+	}
+}
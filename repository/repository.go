@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"we-credit/logging"
+	"we-credit/models"
+	"we-credit/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	logger = logging.For("repository")
+	tracer = tracing.Tracer("repository")
+)
+
+// ErrOTPExpired is returned by GetValidVerificationCode when the user's OTP is past its validity.
+var ErrOTPExpired = errors.New("OTP is expired")
+
+// UserRepository stores and fetches users.
+type UserRepository interface {
+	// SaveNewUser inserts the user or refreshes the OTP of an existing one and
+	// returns "insert" or "update" depending on which happened.
+	SaveNewUser(ctx context.Context, user *models.User) (string, error)
+	GetUserByID(ctx context.Context, userID int) (models.User, error)
+	// GetUserProfile returns an empty user, with a zero ID, and no error when the user does not exist.
+	GetUserProfile(ctx context.Context, userID int) (models.User, error)
+}
+
+// OTPRepository stores and verifies the one time passwords sent to users.
+type OTPRepository interface {
+	SaveOTP(ctx context.Context, user models.User) (models.User, error)
+	GetValidVerificationCode(ctx context.Context, userID int64) (string, error)
+	SetPhoneVerified(ctx context.Context, userID int64) error
+}
+
+// SessionRepository stores the authenticated sessions of users.
+type SessionRepository interface {
+	CreateNewSession(ctx context.Context, session models.Session) error
+}
+
+// CountryRepository looks up the countries supported by the application.
+type CountryRepository interface {
+	GetDetailsOfSupportedCountryByCode(ctx context.Context, countryCode string) (models.CountryDetail, error)
+	CheckCountryIsSupported(ctx context.Context, countryCode string) (bool, error)
+}
+
+// RegistrationRepository persists a registration as a single unit of work.
+type RegistrationRepository interface {
+	// RegisterUser saves the user with its OTP challenge and enqueues the
+	// verification SMS, built by message from the saved user, in one transaction.
+	// It sets user.ID and user.IsPhoneVerified and returns "insert" or "update".
+	RegisterUser(ctx context.Context, user *models.User, message func(models.User) string) (string, error)
+}
+
+// OutboxRepository hands the queued SMS to the dispatcher and records the outcome of every delivery.
+type OutboxRepository interface {
+	// ClaimPendingSMS returns up to limit SMS that are due and hides them from
+	// other callers for lease, so several instances never send the same SMS concurrently.
+	ClaimPendingSMS(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxSMS, error)
+	MarkSMSSent(ctx context.Context, id int64) error
+	// MarkSMSFailed records a failed delivery. The SMS is retried at retryAt unless giveUp is set.
+	MarkSMSFailed(ctx context.Context, id int64, reason string, retryAt time.Time, giveUp bool) error
+}
+
+// IdempotencyRepository stores the responses replayed to retries of requests
+// made with an Idempotency-Key header.
+type IdempotencyRepository interface {
+	// ClaimIdempotencyKey reserves key for lease, or returns the stored key and false when another request holds it.
+	ClaimIdempotencyKey(ctx context.Context, key models.IdempotencyKey, lease time.Duration) (models.IdempotencyKey, bool, error)
+	// CompleteIdempotencyKey stores the response of a claimed key, replayed for ttl from the first request.
+	CompleteIdempotencyKey(ctx context.Context, key models.IdempotencyKey, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+// Postgres implements every repository on top of the shared connection pool.
+type Postgres struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+
+	// replica serves read-only queries when configured and healthy, see UseReplica.
+	replica *replica
+
+	// stmts caches prepared statements by pool and query text.
+	mu    sync.RWMutex
+	stmts map[stmtKey]*sql.Stmt
+}
+
+// stmtKey identifies a prepared statement; the same query is prepared once per pool.
+type stmtKey struct {
+	db    *sql.DB
+	query string
+}
+
+// NewPostgres returns a Postgres repository using the given connection pool.
+// Every query is bounded by queryTimeout on top of the caller's context; a zero
+// queryTimeout leaves the caller's deadline untouched.
+func NewPostgres(db *sql.DB, queryTimeout time.Duration) *Postgres {
+	return &Postgres{
+		db:           db,
+		queryTimeout: queryTimeout,
+		stmts:        make(map[stmtKey]*sql.Stmt),
+	}
+}
+
+// Close releases every cached prepared statement. The connection pool itself
+// is owned, and closed, by the caller.
+func (r *Postgres) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for key, stmt := range r.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.stmts, key)
+	}
+	return firstErr
+}
+
+// withTimeout derives the context a single query runs with. The returned
+// context is cancelled when the caller's context is (e.g. the client disconnects)
+// or when the per-query timeout elapses, whichever happens first.
+func (r *Postgres) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+// prepare returns the cached prepared statement for query on db, preparing it
+// the first time it is seen. Only constant queries with $n placeholders may be
+// passed here, since the query text is the cache key. The statement is prepared
+// without holding r.mu, a round trip to Postgres, so that a slow prepare does not
+// block the lookups of cached statements; if another goroutine cached the same
+// query meanwhile, its statement is kept and this one closed.
+func (r *Postgres) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	key := stmtKey{db: db, query: query}
+	r.mu.RLock()
+	stmt, ok := r.stmts[key]
+	r.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	prepared, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	stmt, ok = r.stmts[key]
+	if !ok {
+		r.stmts[key] = prepared
+	}
+	r.mu.Unlock()
+	if ok {
+		prepared.Close()
+		return stmt, nil
+	}
+	return prepared, nil
+}
+
+// startSpan starts the span of a single query on db. Queries only carry $n
+// placeholders, so the statement is recorded as is without leaking any argument.
+func (r *Postgres) startSpan(ctx context.Context, db *sql.DB, query string) (context.Context, trace.Span) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(strings.TrimSpace(operation))
+	return tracer.Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+			attribute.Bool("db.replica", db != r.db),
+		),
+	)
+}
+
+// queryRow runs query on the primary through its cached prepared statement.
+func (r *Postgres) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.queryRowOn(ctx, r.db, query, args...)
+}
+
+// queryRowOn runs query on db through its cached prepared statement. If the statement
+// cannot be prepared the query is sent unprepared so the error, if any, surfaces on Scan.
+func (r *Postgres) queryRowOn(ctx context.Context, db *sql.DB, query string, args ...any) (row *sql.Row) {
+	ctx, span := r.startSpan(ctx, db, query)
+	defer func() { tracing.End(span, row.Err()) }()
+
+	stmt, err := r.prepare(ctx, db, query)
+	if err != nil {
+		logger.WarnContext(ctx, "queryRow: failed to prepare statement, running it unprepared", "error", err)
+		return db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// query runs query through its cached prepared statement, see queryRow.
+func (r *Postgres) query(ctx context.Context, query string, args ...any) (rows *sql.Rows, err error) {
+	ctx, span := r.startSpan(ctx, r.db, query)
+	defer func() { tracing.End(span, err) }()
+
+	stmt, err := r.prepare(ctx, r.db, query)
+	if err != nil {
+		logger.WarnContext(ctx, "query: failed to prepare statement, running it unprepared", "error", err)
+		return r.db.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// txQueryRow is queryRow bound to the transaction tx.
+func (r *Postgres) txQueryRow(ctx context.Context, tx *sql.Tx, query string, args ...any) (row *sql.Row) {
+	ctx, span := r.startSpan(ctx, r.db, query)
+	defer func() { tracing.End(span, row.Err()) }()
+
+	stmt, err := r.prepare(ctx, r.db, query)
+	if err != nil {
+		logger.WarnContext(ctx, "txQueryRow: failed to prepare statement, running it unprepared", "error", err)
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	return tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+}
+
+// txExec is exec bound to the transaction tx.
+func (r *Postgres) txExec(ctx context.Context, tx *sql.Tx, query string, args ...any) (result sql.Result, err error) {
+	ctx, span := r.startSpan(ctx, r.db, query)
+	defer func() { tracing.End(span, err) }()
+
+	stmt, err := r.prepare(ctx, r.db, query)
+	if err != nil {
+		logger.WarnContext(ctx, "txExec: failed to prepare statement, running it unprepared", "error", err)
+		return tx.ExecContext(ctx, query, args...)
+	}
+	return tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+}
+
+// exec runs query through its cached prepared statement, see queryRow.
+func (r *Postgres) exec(ctx context.Context, query string, args ...any) (result sql.Result, err error) {
+	ctx, span := r.startSpan(ctx, r.db, query)
+	defer func() { tracing.End(span, err) }()
+
+	stmt, err := r.prepare(ctx, r.db, query)
+	if err != nil {
+		logger.WarnContext(ctx, "exec: failed to prepare statement, running it unprepared", "error", err)
+		return r.db.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// Compile time checks that both implementations satisfy every repository.
+var (
+	_ UserRepository         = (*Postgres)(nil)
+	_ OTPRepository          = (*Postgres)(nil)
+	_ SessionRepository      = (*Postgres)(nil)
+	_ CountryRepository      = (*Postgres)(nil)
+	_ RegistrationRepository = (*Postgres)(nil)
+	_ OutboxRepository       = (*Postgres)(nil)
+	_ IdempotencyRepository  = (*Postgres)(nil)
+	_ UserRepository         = (*Memory)(nil)
+	_ OTPRepository          = (*Memory)(nil)
+	_ SessionRepository      = (*Memory)(nil)
+	_ CountryRepository      = (*Memory)(nil)
+	_ RegistrationRepository = (*Memory)(nil)
+	_ OutboxRepository       = (*Memory)(nil)
+	_ IdempotencyRepository  = (*Memory)(nil)
+)
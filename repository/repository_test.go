@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"we-credit/logging"
+	"we-credit/repository/stubdb"
+)
+
+func TestMain(m *testing.M) {
+	// the repository logs every failure it returns, which would drown the test output
+	logging.Setup(logging.Options{Output: io.Discard, Level: slog.LevelError})
+	os.Exit(m.Run())
+}
+
+// TestPrepareDoesNotBlockCachedStatements makes sure a statement being prepared
+// on a slow connection does not hold up the queries whose statement is cached.
+func TestPrepareDoesNotBlockCachedStatements(t *testing.T) {
+	fast := sql.OpenDB(&stubdb.Connector{})
+	defer fast.Close()
+	slow := sql.OpenDB(&stubdb.Connector{ConnectLatency: 500 * time.Millisecond})
+	defer slow.Close()
+	repo := NewPostgres(fast, 0)
+	defer repo.Close()
+
+	ctx := context.Background()
+	cached, err := repo.prepare(ctx, fast, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preparing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		close(preparing)
+		_, err := repo.prepare(ctx, slow, "SELECT 2")
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-preparing
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	stmt, err := repo.prepare(ctx, fast, "SELECT 1")
+	if err != nil || stmt != cached {
+		t.Errorf("prepare = %p, %v, want the cached statement %p", stmt, err, cached)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("the cached statement took %v, blocked by the slow prepare", elapsed)
+	}
+	<-done
+}
+
+// TestPrepareConcurrently makes sure goroutines preparing the same query all get
+// the one statement that is cached.
+func TestPrepareConcurrently(t *testing.T) {
+	db := sql.OpenDB(&stubdb.Connector{ConnectLatency: time.Millisecond})
+	defer db.Close()
+	repo := NewPostgres(db, 0)
+	defer repo.Close()
+
+	stmts := make([]*sql.Stmt, 8)
+	var wg sync.WaitGroup
+	for i := range stmts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stmt, err := repo.prepare(context.Background(), db, "SELECT 1")
+			if err != nil {
+				t.Error(err)
+			}
+			stmts[i] = stmt
+		}()
+	}
+	wg.Wait()
+
+	cached := repo.stmts[stmtKey{db: db, query: "SELECT 1"}]
+	for i, stmt := range stmts {
+		if stmt != cached {
+			t.Errorf("goroutine %d got %p, want the cached statement %p", i, stmt, cached)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// queryArgs maps the functions and methods that send SQL to Postgres, those of
+// database/sql and the helpers of Postgres, to the index of their query argument.
+var queryArgs = map[string]int{
+	"Query":           0,
+	"QueryRow":        0,
+	"Exec":            0,
+	"Prepare":         0,
+	"QueryContext":    1,
+	"QueryRowContext": 1,
+	"ExecContext":     1,
+	"PrepareContext":  1,
+	"query":           1,
+	"queryRow":        1,
+	"exec":            1,
+	"readRow":         1,
+	"queryRowOn":      2,
+	"txQueryRow":      2,
+	"txExec":          2,
+	"prepare":         2,
+}
+
+// stmtSources are the calls returning a prepared statement, whose own Query and
+// Exec methods take arguments rather than SQL.
+var stmtSources = map[string]bool{
+	"Prepare":        true,
+	"PrepareContext": true,
+	"Stmt":           true,
+	"StmtContext":    true,
+	"prepare":        true,
+}
+
+// TestQueriesAreConstant fails when a query sent to Postgres is not a constant
+// string, e.g. built with +, += , fmt.Sprintf, strings.Join or strconv. Every
+// query must be a constant with $n placeholders so that values are always sent
+// as parameters and prepared statements can be cached by their text.
+func TestQueriesAreConstant(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, f)
+	}
+
+	for _, finding := range checkQueries(fset, parsed) {
+		t.Error(finding)
+	}
+}
+
+// TestCheckQueries makes sure the check of TestQueriesAreConstant catches the
+// ways SQL gets built from values, and accepts the constant forms the repository uses.
+func TestCheckQueries(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		unsafe bool
+	}{
+		{"literal", "db.QueryRowContext(ctx, `SELECT 1 WHERE id = $1`, id)", false},
+		{"package constant", "r.queryRow(ctx, packageQuery, id)", false},
+		{"constant concatenation", "r.exec(ctx, packageQuery+` LIMIT 1`)", false},
+		{"local from literal", "query := `SELECT 1`\nr.readRow(ctx, query, nil)", false},
+		{"local constant", "const query = `SELECT 1`\ndb.Exec(query)", false},
+		{"local reassigned literal", "query := `SELECT 1`\nif id > 0 {\nquery = `SELECT 2`\n}\ndb.Query(query)", false},
+		{"prepared statement", "stmt, _ := r.prepare(ctx, db, packageQuery)\nstmt.QueryRowContext(ctx, id)", false},
+		{"transaction statement", "tx.StmtContext(ctx, stmt).ExecContext(ctx, id)", false},
+		{"concatenated value", "db.Query(`SELECT 1 WHERE id = ` + strconv.Itoa(id))", true},
+		{"appended column", "query := `SELECT `\nquery += col\ndb.Query(query)", true},
+		{"sprintf", "db.QueryContext(ctx, fmt.Sprintf(`SELECT %s`, col))", true},
+		{"sprint", "r.txExec(ctx, tx, fmt.Sprint(`DELETE FROM `, table))", true},
+		{"strings.Join", "r.queryRowOn(ctx, db, strings.Join(parts, ` `))", true},
+		{"parameter", "db.Exec(col)", true},
+		{"field", "db.Exec(r.query)", true},
+		{"local from value", "query := col\ndb.Prepare(query)", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := fmt.Sprintf("package p\n\nconst packageQuery = `SELECT 1`\n\nfunc f(col string) {\n%s\n}\n", test.body)
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, "p.go", src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings := checkQueries(fset, []*ast.File{f})
+			if test.unsafe && len(findings) == 0 {
+				t.Errorf("%q was not reported", test.body)
+			}
+			if !test.unsafe && len(findings) > 0 {
+				t.Errorf("%q was reported: %v", test.body, findings)
+			}
+		})
+	}
+}
+
+// checkQueries returns every place in files where a non constant query is sent to Postgres.
+func checkQueries(fset *token.FileSet, files []*ast.File) []string {
+	constants := map[string]bool{}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					constants[name.Name] = true
+				}
+			}
+		}
+	}
+
+	var findings []string
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			c := queryChecker{fn: fn, constants: constants, visiting: map[*ast.Object]bool{}}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				call, ok := node.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				name, receiver := calledName(call)
+				index, sendsSQL := queryArgs[name]
+				if !sendsSQL || index >= len(call.Args) || (receiver != nil && c.isStmt(receiver)) {
+					return true
+				}
+				if !c.isConstant(call.Args[index]) {
+					findings = append(findings, fmt.Sprintf("%s: the query passed to %s is not a constant string, use a constant with $n placeholders",
+						fset.Position(call.Args[index].Pos()), name))
+				}
+				return true
+			})
+		}
+	}
+	return findings
+}
+
+// calledName returns the name of the function or method call calls, and the receiver of a method.
+func calledName(call *ast.CallExpr) (string, ast.Expr) {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name, nil
+	case *ast.SelectorExpr:
+		return fun.Sel.Name, fun.X
+	}
+	return "", nil
+}
+
+// queryChecker decides whether the expressions of a function are constant strings.
+type queryChecker struct {
+	fn        *ast.FuncDecl
+	constants map[string]bool
+	// visiting guards against variables assigned from each other.
+	visiting map[*ast.Object]bool
+}
+
+// isConstant reports whether expr only ever holds a string built from literals and constants.
+func (c queryChecker) isConstant(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return e.Kind == token.STRING
+	case *ast.ParenExpr:
+		return c.isConstant(e.X)
+	case *ast.BinaryExpr:
+		return e.Op == token.ADD && c.isConstant(e.X) && c.isConstant(e.Y)
+	case *ast.Ident:
+		if e.Obj == nil {
+			// declared in another file of the package
+			return c.constants[e.Name]
+		}
+		switch e.Obj.Kind {
+		case ast.Con:
+			return true
+		case ast.Var:
+			return c.isConstantVar(e.Obj)
+		}
+	}
+	return false
+}
+
+// isConstantVar reports whether every value assigned to the variable obj is constant.
+// The query parameter of the functions in queryArgs is checked where they are called.
+func (c queryChecker) isConstantVar(obj *ast.Object) bool {
+	if field, ok := obj.Decl.(*ast.Field); ok {
+		return c.isQueryParam(field, obj.Name)
+	}
+	if c.visiting[obj] {
+		return false
+	}
+	c.visiting[obj] = true
+	defer delete(c.visiting, obj)
+
+	if spec, ok := obj.Decl.(*ast.ValueSpec); ok {
+		for i, name := range spec.Names {
+			if name.Obj == obj && i < len(spec.Values) && !c.isConstant(spec.Values[i]) {
+				return false
+			}
+		}
+	}
+	constant := true
+	ast.Inspect(c.fn.Body, func(node ast.Node) bool {
+		assign, ok := node.(*ast.AssignStmt)
+		if !ok {
+			return constant
+		}
+		for i, lhs := range assign.Lhs {
+			ident, ok := lhs.(*ast.Ident)
+			if !ok || ident.Obj != obj {
+				continue
+			}
+			if (assign.Tok != token.DEFINE && assign.Tok != token.ASSIGN) ||
+				len(assign.Rhs) != len(assign.Lhs) || !c.isConstant(assign.Rhs[i]) {
+				constant = false
+			}
+		}
+		return constant
+	})
+	return constant
+}
+
+// isQueryParam reports whether the parameter name declared by field is the query
+// argument of the function being checked, when that function is one of queryArgs.
+func (c queryChecker) isQueryParam(field *ast.Field, name string) bool {
+	index, sendsSQL := queryArgs[c.fn.Name.Name]
+	if !sendsSQL {
+		return false
+	}
+	i := 0
+	for _, param := range c.fn.Type.Params.List {
+		for _, paramName := range param.Names {
+			if i == index {
+				return param == field && paramName.Name == name
+			}
+			i++
+		}
+	}
+	return false
+}
+
+// isStmt reports whether expr is a prepared statement, e.g. the result of prepare or tx.StmtContext.
+func (c queryChecker) isStmt(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.CallExpr:
+		name, _ := calledName(e)
+		return stmtSources[name]
+	case *ast.Ident:
+		if e.Obj == nil {
+			return false
+		}
+		switch decl := e.Obj.Decl.(type) {
+		case *ast.AssignStmt:
+			return len(decl.Rhs) == 1 && c.isStmt(decl.Rhs[0])
+		case *ast.ValueSpec:
+			return isStmtType(decl.Type)
+		case *ast.Field:
+			return isStmtType(decl.Type)
+		}
+	}
+	return false
+}
+
+// isStmtType reports whether typ is *sql.Stmt.
+func isStmtType(typ ast.Expr) bool {
+	star, ok := typ.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Stmt"
+}
@@ -0,0 +1,147 @@
+// Package stubdb is a database/sql driver answering queries from a function, so
+// that the Postgres repository, its prepared statements and the connection pool
+// can be exercised in tests without a database. Open a pool with sql.OpenDB.
+package stubdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Query is a statement sent to the stub database, with its arguments.
+type Query struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// Rows is the answer to a query.
+type Rows struct {
+	Columns []string
+	Values  [][]driver.Value
+}
+
+// Connector opens connections to a stub database answering every query with Answer.
+type Connector struct {
+	// Answer returns the rows of a query; the rows of an Exec are ignored.
+	Answer func(query Query) (Rows, error)
+	// Record keeps the queries sent for Queries.
+	Record bool
+	// ConnectLatency is what opening a connection costs, standing for the TCP,
+	// TLS and authentication round trips of a real server.
+	ConnectLatency time.Duration
+
+	opened  atomic.Int64
+	mu      sync.Mutex
+	queries []Query
+}
+
+// Opened returns how many connections were opened.
+func (c *Connector) Opened() int64 {
+	return c.opened.Load()
+}
+
+// Queries returns the queries sent so far, in order, when Record is set.
+func (c *Connector) Queries() []Query {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Query(nil), c.queries...)
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.ConnectLatency > 0 {
+		select {
+		case <-time.After(c.ConnectLatency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c.opened.Add(1)
+	return conn{c}, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return stubDriver{}
+}
+
+// answer records query, if asked to, and answers it.
+func (c *Connector) answer(query Query) (Rows, error) {
+	if c.Record {
+		c.mu.Lock()
+		c.queries = append(c.queries, query)
+		c.mu.Unlock()
+	}
+	if c.Answer == nil {
+		return Rows{}, nil
+	}
+	return c.Answer(query)
+}
+
+// stubDriver only exists to satisfy driver.Connector, connections are opened through sql.OpenDB.
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("stubdb: use sql.OpenDB with a Connector")
+}
+
+type conn struct {
+	connector *Connector
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	return stmt{connector: c.connector, query: query}, nil
+}
+
+func (conn) Close() error { return nil }
+
+func (conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type stmt struct {
+	connector *Connector
+	query     string
+}
+
+func (stmt) Close() error  { return nil }
+func (stmt) NumInput() int { return -1 }
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, err := s.connector.answer(Query{SQL: s.query, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	answer, err := s.connector.answer(Query{SQL: s.query, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: answer.Columns, values: answer.Values}, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
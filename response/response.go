@@ -0,0 +1,142 @@
+// Package response writes the JSON bodies shared by every handler. Failures use
+// one envelope carrying a machine readable code, so that clients can branch on
+// the code instead of on the message:
+//
+//	{"status": "Failed", "code": "OTP_EXPIRED", "message": "The code has expired, please request a new one."}
+package response
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code identifies a failure independently of its human readable message.
+type Code string
+
+// Codes returned by the API. Existing codes must never change meaning, clients depend on them.
+const (
+	CodeInvalidRequest      Code = "INVALID_REQUEST"
+	CodePhoneInvalid        Code = "PHONE_INVALID"
+	CodePhoneUndeliverable  Code = "PHONE_UNDELIVERABLE"
+	CodePhoneVoip           Code = "PHONE_VOIP_NOT_ALLOWED"
+	CodeUserIDInvalid       Code = "USER_ID_INVALID"
+	CodeUserNotFound        Code = "USER_NOT_FOUND"
+	CodeOTPRequired         Code = "OTP_REQUIRED"
+	CodeOTPInvalid          Code = "OTP_INVALID"
+	CodeOTPExpired          Code = "OTP_EXPIRED"
+	CodeSMSFailed           Code = "SMS_SEND_FAILED"
+	CodeProviderUnavailable Code = "PROVIDER_UNAVAILABLE"
+	CodeRateLimited         Code = "RATE_LIMITED"
+	CodeIdempotencyReused   Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyPending  Code = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	CodeUnauthorized        Code = "UNAUTHORIZED"
+	CodeCSRF                Code = "CSRF_REJECTED"
+	CodeNotFound            Code = "NOT_FOUND"
+	CodeInternal            Code = "INTERNAL_ERROR"
+)
+
+// Error is a failure the API reports to the client. Cause, if any, is kept for
+// logging and errors.Is/As but never sent to the client.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Cause   error
+}
+
+// New returns an Error answered with the given HTTP status.
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Cause.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Wrap returns a copy of e caused by cause.
+func (e *Error) Wrap(cause error) *Error {
+	wrapped := *e
+	wrapped.Cause = cause
+	return &wrapped
+}
+
+// Is reports whether target is an Error with the same code, so that
+// errors.Is(err, response.ErrOTPExpired) works on wrapped copies.
+func (e *Error) Is(target error) bool {
+	var other *Error
+	return errors.As(target, &other) && other.Code == e.Code
+}
+
+// The errors returned by the handlers, with their HTTP status.
+var (
+	ErrInvalidRequest      = New(http.StatusBadRequest, CodeInvalidRequest, "The request is malformed.")
+	ErrPhoneInvalid        = New(http.StatusBadRequest, CodePhoneInvalid, "Please enter a valid phone number.")
+	ErrPhoneUndeliverable  = New(http.StatusUnprocessableEntity, CodePhoneUndeliverable, "This phone number can not receive SMS, please enter a valid number.")
+	ErrPhoneVoip           = New(http.StatusUnprocessableEntity, CodePhoneVoip, "Virtual phone numbers are not supported, please enter a mobile number.")
+	ErrUserIDInvalid       = New(http.StatusBadRequest, CodeUserIDInvalid, "Please enter a valid user id.")
+	ErrUserNotFound        = New(http.StatusNotFound, CodeUserNotFound, "User not found.")
+	ErrOTPRequired         = New(http.StatusBadRequest, CodeOTPRequired, "Please enter the verification code.")
+	ErrOTPInvalid          = New(http.StatusUnauthorized, CodeOTPInvalid, "The verification code is incorrect.")
+	ErrOTPExpired          = New(http.StatusUnauthorized, CodeOTPExpired, "The verification code has expired, please request a new one.")
+	ErrSMSFailed           = New(http.StatusBadGateway, CodeSMSFailed, "Failed to send the verification code, please try again later.")
+	ErrProviderUnavailable = New(http.StatusServiceUnavailable, CodeProviderUnavailable, "Phone verification is unavailable, please try again later.")
+	ErrRateLimited         = New(http.StatusTooManyRequests, CodeRateLimited, "Too many requests, please try again later.")
+	ErrIdempotencyInvalid  = New(http.StatusBadRequest, CodeInvalidRequest, "The Idempotency-Key header must be 1 to 255 printable characters.")
+	ErrIdempotencyReused   = New(http.StatusUnprocessableEntity, CodeIdempotencyReused, "This Idempotency-Key was already used for a different request.")
+	ErrIdempotencyPending  = New(http.StatusConflict, CodeIdempotencyPending, "A request with this Idempotency-Key is still being processed, please retry shortly.")
+	ErrUnauthorized        = New(http.StatusUnauthorized, CodeUnauthorized, "Authentication required.")
+	ErrCSRF                = New(http.StatusForbidden, CodeCSRF, "Cross-site request rejected.")
+	ErrNotFound            = New(http.StatusNotFound, CodeNotFound, "Not found.")
+	ErrInternal            = New(http.StatusInternalServerError, CodeInternal, "Something went wrong, please try again later.")
+)
+
+// Values of the "status" field every body carries.
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "Failed"
+)
+
+// ErrorBody is the envelope of every failed request.
+type ErrorBody struct {
+	Status  string `json:"status"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// OK writes a successful response. The Status field of body should be StatusSuccess.
+func OK(c *gin.Context, body any) {
+	c.JSON(http.StatusOK, body)
+}
+
+// Fail aborts the request with the error envelope. Errors that are not an *Error
+// are answered as ErrInternal, so that internal details never reach the client.
+func Fail(c *gin.Context, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrInternal
+	}
+	c.AbortWithStatusJSON(apiErr.Status, ErrorBody{
+		Status:  StatusFailed,
+		Code:    apiErr.Code,
+		Message: apiErr.Message,
+	})
+}
+
+// NotFound answers requests that match no route, see gin.Engine.NoRoute.
+func NotFound(c *gin.Context) {
+	Fail(c, ErrNotFound)
+}
+
+// Recovered answers requests whose handler panicked, see gin.CustomRecovery.
+func Recovered(c *gin.Context, _ any) {
+	Fail(c, ErrInternal)
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"we-credit/config"
+	"we-credit/health"
+	"we-credit/logging"
+	"we-credit/metrics"
+	"we-credit/openapi"
+	"we-credit/response"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-contrib/pprof"
+	"github.com/gin-gonic/gin"
+	swaggerfiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+var logger = logging.For("routes")
+
+// SetupAdminRouter sets up the routes of the admin listener: pprof, the OpenAPI
+// document spec with its swagger UI, the Prometheus metrics, the probes and the
+// admin APIs. None of them are reachable from the public router.
+func SetupAdminRouter(cfg config.Config, checker *health.Checker, spec *openapi3.T) *gin.Engine {
+	router := gin.New()
+	router.Use(logging.Middleware(), gin.CustomRecovery(response.Recovered), adminAuth(cfg.Admin))
+
+	router.GET("/healthz", checker.Liveness)
+	router.GET("/readyz", checker.Readiness)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	router.GET("/openapi.json", openapi.Handler(spec))
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler, ginSwagger.URL("/openapi.json")))
+	pprof.Register(router)
+
+	admin := router.Group("/admin")
+	{
+		// These apis read and change the log levels without a restart.
+		admin.GET("/log-levels", getLogLevels)
+		admin.PUT("/log-levels", setLogLevels)
+	}
+	return router
+}
+
+// adminAuth requires basic auth and/or a bearer token when configured; with
+// neither configured every request is let through.
+func adminAuth(admin config.AdminConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !admin.HasAuth() {
+			c.Next()
+			return
+		}
+
+		if admin.Token != "" {
+			token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if found && equal(token, admin.Token) {
+				c.Next()
+				return
+			}
+		}
+		if admin.Username != "" {
+			username, password, ok := c.Request.BasicAuth()
+			if ok && equal(username, admin.Username) && equal(password, admin.Password) {
+				c.Next()
+				return
+			}
+			c.Header("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+		}
+		response.Fail(c, response.ErrUnauthorized)
+	}
+}
+
+// equal compares secrets in constant time, hashing them first so that their length does not leak either.
+func equal(given, expected string) bool {
+	a := sha256.Sum256([]byte(given))
+	b := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// logLevels is the body of the log level admin api.
+type logLevels struct {
+	// Level is the default level: debug, info, warn or error.
+	Level string `json:"level"`
+	// Packages overrides Level per package, e.g. "repository=debug,outbox=warn".
+	Packages string `json:"packages"`
+}
+
+// getLogLevels returns the log levels in effect.
+func getLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, currentLogLevels())
+}
+
+// setLogLevels replaces the log levels in effect until the next restart.
+func setLogLevels(c *gin.Context) {
+	var body logLevels
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest)
+		return
+	}
+	level, packages, err := logging.ParseLevels(body.Level, body.Packages)
+	if err != nil {
+		response.Fail(c, response.New(http.StatusBadRequest, response.CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	logging.SetLevels(level, packages)
+	logger.InfoContext(c.Request.Context(), "Admin: log levels changed", "level", body.Level, "packages", body.Packages)
+	c.JSON(http.StatusOK, currentLogLevels())
+}
+
+// currentLogLevels formats the log levels in effect the way setLogLevels accepts them.
+func currentLogLevels() logLevels {
+	level, packages := logging.Levels()
+	overrides := make([]string, 0, len(packages))
+	for pkg, lvl := range packages {
+		overrides = append(overrides, pkg+"="+strings.ToLower(lvl.String()))
+	}
+	return logLevels{Level: strings.ToLower(level.String()), Packages: strings.Join(overrides, ",")}
+}
@@ -1,45 +1,112 @@
 package routes
 
 import (
+	"strconv"
+	"time"
+	"we-credit/config"
 	"we-credit/controllers"
-	"we-credit/docs"
-	"we-credit/utility"
+	"we-credit/health"
+	"we-credit/logging"
+	"we-credit/metrics"
+	"we-credit/response"
+	"we-credit/security"
 
 	"github.com/gin-gonic/gin"
-
-	swaggerfiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// APIPrefix is where the current version of the API is mounted.
+const APIPrefix = "/api/v1"
+
+// legacyDeprecatedAt is when the unversioned /user routes were deprecated in favour of APIPrefix.
+var legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// UserPrefixes returns the prefixes the routes of AddRoutes are served under, the current one first.
+func UserPrefixes() []string {
+	return []string{APIPrefix + "/user", "/user"}
+}
+
+// Middlewares are the middlewares SetupRouter adds around the product API. A nil middleware is skipped.
+type Middlewares struct {
+	// Validate checks the API traffic against the OpenAPI document, see openapi.Middleware.
+	Validate gin.HandlerFunc
+	// Idempotent replays the response to retries of the routes that send an OTP, see idempotency.Middleware.
+	Idempotent gin.HandlerFunc
+}
+
+// handlers returns handler preceded by the non nil middlewares.
+func handlers(handler gin.HandlerFunc, middlewares ...gin.HandlerFunc) []gin.HandlerFunc {
+	var result []gin.HandlerFunc
+	for _, middleware := range middlewares {
+		if middleware != nil {
+			result = append(result, middleware)
+		}
+	}
+	return append(result, handler)
+}
+
 // AddRoutes is responsible for adding all the routes so the server can handle
 // new routes. this means that we can reuse this function for multiple prefixes.
 // prefixes like job_portal are necessary for legacy url handling.
-func AddRoutes(router *gin.RouterGroup) {
+func AddRoutes(router *gin.RouterGroup, ctrl *controllers.Controller, mw Middlewares) {
 
 	// NOTE :- all api must be in this group and for every particular feature apis must be create new group.
 	api := router.Group("/user")
 	{
 
 		// This api is responsible for user registration
-		api.POST("/authenticate", controllers.UserRegistration)
-		api.POST("/otp/verify", controllers.VerifyCode)
+		api.POST("/authenticate", handlers(ctrl.UserRegistration, mw.Idempotent)...)
+		api.POST("/otp/verify", ctrl.VerifyCode)
 		// This api is responsible for resend otp on phone number.
-		api.POST("/otp/send", controllers.ResendVerificationCode)
+		api.POST("/otp/send", handlers(ctrl.ResendVerificationCode, mw.Idempotent)...)
 		//This api is responsible for fetching user profile from database.
-		api.GET("/profile", controllers.GetUserProfile)
+		api.GET("/profile", ctrl.GetUserProfile)
 
 	}
 
 }
 
-// SetupRouter sets up routes
-func SetupRouter() *gin.Engine {
+// SetupRouter sets up the public routes: the product API served by the given
+// controller, plus the /healthz (liveness) and /readyz (readiness) probes
+// answered by checker, without the errors of the checks. Everything internal,
+// including the detailed readiness report, is served by SetupAdminRouter.
+func SetupRouter(cfg config.Config, ctrl *controllers.Controller, checker *health.Checker, mw Middlewares) *gin.Engine {
 
-	router := gin.Default()
-	docs.SwaggerInfo.BasePath = "/user"
-	url := ginSwagger.URL(utility.GetHostURL() + "/swagger/doc.json")
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler, url))
+	if cfg.Server.GinMode != "" {
+		gin.SetMode(cfg.Server.GinMode)
+	}
+	// gin's text logger is replaced by structured access logs carrying the request id
+	router := gin.New()
+	// the client address is resolved by clientip, gin must not believe forwarding headers on its own
+	_ = router.SetTrustedProxies(nil)
+	// validated by config.Load
+	resolver, _ := cfg.Server.ClientIPResolver()
+	// the tracing middleware runs first so that access logs carry the trace id
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName), resolver.Middleware(), logging.Middleware(), metrics.Middleware(), gin.CustomRecovery(response.Recovered))
+	// preflight requests are answered before they reach validation or a handler
+	router.Use(security.Headers(cfg.Server, cfg.Security), security.CORS(cfg.Security))
+	if mw.Validate != nil {
+		router.Use(mw.Validate)
+	}
+	// the session cookie must not let another site act on behalf of the user
+	router.Use(security.CSRF(cfg))
+	router.NoRoute(response.NotFound)
+	router.GET("/healthz", checker.Liveness)
+	router.GET("/readyz", checker.PublicReadiness)
 	// Add all current URls
-	AddRoutes(&router.RouterGroup)
+	AddRoutes(router.Group(APIPrefix), ctrl, mw)
+	// Legacy URLs, kept until every client has moved to APIPrefix
+	AddRoutes(router.Group("", deprecated(APIPrefix)), ctrl, mw)
 	return router
 }
+
+// deprecated marks the responses of legacy routes with the Deprecation header
+// (RFC 9745) and points clients at the same route under successorPrefix.
+func deprecated(successorPrefix string) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(legacyDeprecatedAt.Unix(), 10)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Link", "<"+successorPrefix+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package security
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"we-credit/config"
+	"we-credit/idempotency"
+	"we-credit/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS headers of the API: the headers browsers may send, and the response headers they may read.
+var (
+	corsMethods        = strings.Join([]string{http.MethodGet, http.MethodPost}, ", ")
+	corsAllowedHeaders = strings.Join([]string{"Content-Type", idempotency.Header, logging.RequestIDHeader}, ", ")
+	corsExposedHeaders = strings.Join([]string{logging.RequestIDHeader, idempotency.ReplayedHeader, "Deprecation", "Link"}, ", ")
+)
+
+// CORS lets the browsers on the origins of CORS_ALLOWED_ORIGINS call the API,
+// and answers their preflight requests. Requests from other origins get no
+// CORS headers, so the browser keeps their responses from the calling page.
+func CORS(security config.SecurityConfig) gin.HandlerFunc {
+	origins := security.CORSOrigins()
+	anyOrigin := slices.Contains(origins, "*")
+	maxAge := strconv.Itoa(int(security.CORSMaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if anyOrigin || slices.Contains(origins, origin) {
+			if anyOrigin {
+				c.Header("Access-Control-Allow-Origin", "*")
+			} else {
+				c.Header("Access-Control-Allow-Origin", origin)
+			}
+			if security.CORSAllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				c.Header("Access-Control-Allow-Methods", corsMethods)
+				c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+				c.Header("Access-Control-Max-Age", maxAge)
+			} else {
+				c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+		}
+		if preflight {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+// Package security holds the middlewares protecting browser clients of the API.
+package security
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"we-credit/config"
+	"we-credit/logging"
+	"we-credit/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logger = logging.For("security")
+
+// CSRF rejects cross-site state-changing requests that carry the session cookie,
+// by checking where the browser says the request comes from:
+//   - Origin, which browsers send on every cross-origin POST, must be the API host
+//     itself, HOST_URL, one of AUTH_TRUSTED_ORIGINS or, when they may send
+//     credentials, one of CORS_ALLOWED_ORIGINS;
+//   - without Origin, Sec-Fetch-Site must be same-origin or none;
+//   - without either, the Referer is checked like Origin.
+//
+// Requests without the cookie, or without any of these headers, e.g. from the
+// mobile apps, are let through: they are not authenticated by an ambient
+// credential a third party site could make the browser send.
+func CSRF(cfg config.Config) gin.HandlerFunc {
+	origins := append(strings.Split(cfg.Auth.TrustedOrigins, ","), cfg.Server.HostURL)
+	if cfg.Security.CORSAllowCredentials {
+		origins = append(origins, cfg.Security.CORSOrigins()...)
+	}
+	trusted := map[string]bool{}
+	for _, origin := range origins {
+		if origin = normalizeOrigin(origin); origin != "" {
+			trusted[origin] = true
+		}
+	}
+	cookie := cfg.Auth.Cookie()
+
+	return func(c *gin.Context) {
+		if safeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if _, err := c.Cookie(cookie); err != nil {
+			c.Next()
+			return
+		}
+
+		allowed, source := true, ""
+		if origin := c.GetHeader("Origin"); origin != "" {
+			allowed, source = trustedOrigin(c, trusted, origin), "origin"
+		} else if site := c.GetHeader("Sec-Fetch-Site"); site != "" {
+			allowed, source = site == "same-origin" || site == "none", "sec-fetch-site"
+		} else if referer := c.GetHeader("Referer"); referer != "" {
+			allowed, source = trustedOrigin(c, trusted, referer), "referer"
+		}
+		if !allowed {
+			logger.WarnContext(c.Request.Context(), "CSRF: rejected cross-site request", "checked", source, "origin", c.GetHeader("Origin"), "path", c.FullPath())
+			response.Fail(c, response.ErrCSRF)
+			return
+		}
+		c.Next()
+	}
+}
+
+// safeMethod reports whether method must not change state, per RFC 9110.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// trustedOrigin reports whether the origin of rawURL is trusted or is the host the request was sent to.
+func trustedOrigin(c *gin.Context, trusted map[string]bool, rawURL string) bool {
+	origin := normalizeOrigin(rawURL)
+	if origin == "" {
+		return false
+	}
+	if trusted[origin] {
+		return true
+	}
+	// same origin; the scheme is not compared since TLS may end at a proxy
+	_, host, _ := strings.Cut(origin, "://")
+	return strings.EqualFold(host, c.Request.Host)
+}
+
+// normalizeOrigin returns the lower case scheme://host[:port] of rawURL, or "" when it has none.
+func normalizeOrigin(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host)
+}
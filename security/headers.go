@@ -0,0 +1,35 @@
+package security
+
+import (
+	"strconv"
+	"we-credit/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers sets the security headers of the profile configured for the
+// environment, see config.SecurityConfig.Profile. The API only answers JSON,
+// so nothing is allowed to load from, or frame, its responses.
+func Headers(server config.ServerConfig, security config.SecurityConfig) gin.HandlerFunc {
+	profile := security.Profile(server)
+	if profile == "off" {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	headers := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+	}
+	if profile == "strict" {
+		headers["Strict-Transport-Security"] = "max-age=" + strconv.Itoa(int(security.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	}
+
+	return func(c *gin.Context) {
+		for name, value := range headers {
+			c.Header(name, value)
+		}
+		c.Next()
+	}
+}
@@ -1,80 +1,332 @@
 package service
 
 import (
-	"log"
+	"context"
+	"errors"
 	"net"
+	"time"
 
-	"github.com/oschwald/maxminddb-golang"
+	"we-credit/config"
+	"we-credit/logging"
+	"we-credit/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	logger = logging.For("service")
+	tracer = tracing.Tracer("service")
 )
 
 // Location represents geographical information.
 
 type Location struct {
-	Latitude    float64 `json:"Latitude,omitempty"`
-	Longitude   float64 `json:"Longitude,omitempty"`
-	CountryCode string  `json:"country_code,omitempty"`
-	Country     string  `json:"country,omitempty"`
-	PostalCode  string  `json:"postal_code,omitempty"`
-	City        string  `json:"city,omitempty"`
-	State       string  `json:"state,omitempty"`
-	TimeZone    string  `json:"time_zone,omitempty"`
+	Latitude  float64 `json:"Latitude,omitempty"`
+	Longitude float64 `json:"Longitude,omitempty"`
+	// AccuracyRadius is the radius in kilometers around Latitude and Longitude
+	// in which the IP is likely to be.
+	AccuracyRadius uint16 `json:"accuracy_radius,omitempty"`
+	ContinentCode  string `json:"continent_code,omitempty"`
+	Continent      string `json:"continent,omitempty"`
+	CountryCode    string `json:"country_code,omitempty"`
+	Country        string `json:"country,omitempty"`
+	PostalCode     string `json:"postal_code,omitempty"`
+	City           string `json:"city,omitempty"`
+	// State and StateCode are the largest subdivision of the country, Subdivisions[0].
+	State     string `json:"state,omitempty"`
+	StateCode string `json:"state_code,omitempty"`
+	// Subdivisions lists the subdivisions of the country the IP is in, from
+	// the largest to the smallest, e.g. England then Kent in the United Kingdom.
+	Subdivisions []Subdivision `json:"subdivisions,omitempty"`
+	TimeZone     string        `json:"time_zone,omitempty"`
+
+	Network
 }
 
-// GetLocationFromIP convert ip to location
-func GetLocationFromIP(ip string) Location {
-	location := GetLocationLocally(ip)
-	return location
+// Subdivision is a state, province, region or county.
+type Subdivision struct {
+	// Code is the ISO 3166-2 code of the subdivision, without the country prefix, e.g. "CA" for California.
+	Code string `json:"code,omitempty"`
+	Name string `json:"name,omitempty"`
 }
 
-// GetLocationLocally retrieves geographical information based on the provided IP address using a local MaxMind GeoLite2 database.
+// Network describes who operates an IP and whether it hides the real client,
+// for fraud screening. It is read from the optional ASN and anonymous IP databases.
+type Network struct {
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+
+	IsAnonymous        bool `json:"is_anonymous,omitempty"`
+	IsAnonymousVPN     bool `json:"is_anonymous_vpn,omitempty"`
+	IsHostingProvider  bool `json:"is_hosting_provider,omitempty"`
+	IsPublicProxy      bool `json:"is_public_proxy,omitempty"`
+	IsResidentialProxy bool `json:"is_residential_proxy,omitempty"`
+	IsTorExitNode      bool `json:"is_tor_exit_node,omitempty"`
+}
+
+// AnonymizerFlags returns the names of the anonymizer flags that are set, e.g. ["anonymous", "tor_exit_node"],
+// or nil when none is.
+func (network Network) AnonymizerFlags() []string {
+	var flags []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{network.IsAnonymous, "anonymous"},
+		{network.IsAnonymousVPN, "anonymous_vpn"},
+		{network.IsHostingProvider, "hosting_provider"},
+		{network.IsPublicProxy, "public_proxy"},
+		{network.IsResidentialProxy, "residential_proxy"},
+		{network.IsTorExitNode, "tor_exit_node"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return flags
+}
+
+// GeoIP locates client IPs with a MaxMind City database and, when configured,
+// describes their network with the ASN and anonymous IP databases. Every
+// database is opened once and replaced by Watch when its file changes on disk.
+type GeoIP struct {
+	cfg config.GeoIPConfig
+
+	city *mmdb
+	// asn and anonymous are nil when not configured.
+	asn       *mmdb
+	anonymous *mmdb
+
+	cache *lruCache
+}
+
+// NewGeoIP returns a GeoIP reading the databases configured by cfg. A database
+// that cannot be opened is logged and reported by Check; its part of the
+// Location stays empty until Watch loads a valid one.
+func NewGeoIP(cfg config.GeoIPConfig) *GeoIP {
+	geoIP := &GeoIP{
+		cfg:   cfg,
+		city:  &mmdb{path: cfg.Path, inMemory: cfg.InMemory},
+		cache: newLRUCache(cfg.CacheSize),
+	}
+	if cfg.ASNPath != "" {
+		geoIP.asn = &mmdb{path: cfg.ASNPath, inMemory: cfg.InMemory}
+	}
+	if cfg.AnonymousIPPath != "" {
+		geoIP.anonymous = &mmdb{path: cfg.AnonymousIPPath, inMemory: cfg.InMemory}
+	}
+
+	for _, db := range geoIP.databases() {
+		_, err := db.reload()
+		if err != nil {
+			logger.Error("NewGeoIP: failed to open the GeoIP database", "path", db.path, "error", err)
+		}
+	}
+	return geoIP
+}
+
+// databases returns the configured databases.
+func (g *GeoIP) databases() []*mmdb {
+	databases := []*mmdb{g.city}
+	if g.asn != nil {
+		databases = append(databases, g.asn)
+	}
+	if g.anonymous != nil {
+		databases = append(databases, g.anonymous)
+	}
+	return databases
+}
+
+// Lookup returns the location of ip, or an empty Location when it is unknown or
+// the databases are unavailable.
 // Parameters:
+// - ctx: The context of the request, used for tracing and logging.
 // - ip: The IP address for which geographical information is to be retrieved.
+// - languages: The preferred languages of the names, most preferred first, falling back to English.
 // Returns:
-//   - Location: A struct containing country name, country ISO code, city name, postal code, latitude, and longitude.
-//     If an error occurs during database access or lookup, an empty Location struct is returned.
-func GetLocationLocally(ip string) Location {
+//   - Location: A struct containing continent, country, subdivisions, city, postal code, latitude,
+//     longitude with their accuracy radius and the network of the IP.
+func (g *GeoIP) Lookup(ctx context.Context, ip string, languages ...string) Location {
+	ctx, span := tracer.Start(ctx, "geoip lookup", trace.WithSpanKind(trace.SpanKindInternal))
+	var err error
+	defer func() { tracing.End(span, err) }()
 
-	db, err := maxminddb.Open("./db/GeoLite2-City.mmdb")
-	if err != nil {
-		log.Println(err)
-		return Location{}
+	if cached, found := g.cache.get(ip); found {
+		span.SetAttributes(attribute.Bool("geoip.cache_hit", true))
+		return cached.localize(languages)
 	}
-	defer db.Close()
 
 	ipParsed := net.ParseIP(ip)
+	if ipParsed == nil {
+		err = errors.New("invalid ip address")
+		logger.WarnContext(ctx, "Lookup: invalid ip address", "ip", ip)
+		return Location{}
+	}
 
+	var place cachedLocation
+	location := &place.location
+	err = g.lookupCity(ipParsed, location, &place.names)
+	if err != nil {
+		logger.WarnContext(ctx, "Lookup: city lookup failed", "ip", ip, "error", err)
+	}
+	if g.asn != nil {
+		asnErr := g.lookupASN(ipParsed, &location.Network)
+		if asnErr != nil {
+			logger.WarnContext(ctx, "Lookup: ASN lookup failed", "ip", ip, "error", asnErr)
+			err = errors.Join(err, asnErr)
+		}
+	}
+	if g.anonymous != nil {
+		anonymousErr := g.lookupAnonymous(ipParsed, &location.Network)
+		if anonymousErr != nil {
+			logger.WarnContext(ctx, "Lookup: anonymous IP lookup failed", "ip", ip, "error", anonymousErr)
+			err = errors.Join(err, anonymousErr)
+		}
+	}
+
+	// partial results are not cached, so the lookup is retried once the database is back
+	if err == nil {
+		g.cache.add(ip, place)
+	}
+	return place.localize(languages)
+}
+
+// lookupCity fills the geographical fields of location from the City database,
+// and names with the names of its places in every language of the database.
+func (g *GeoIP) lookupCity(ip net.IP, location *Location, names *placeNames) error {
 	var record struct {
+		Continent struct {
+			Code  string            `maxminddb:"code"`
+			Names map[string]string `maxminddb:"names"`
+		} `maxminddb:"continent"`
 		Country struct {
 			ISOCode string            `maxminddb:"iso_code"`
 			Names   map[string]string `maxminddb:"names"`
 		} `maxminddb:"country"`
+		Subdivisions []struct {
+			ISOCode string            `maxminddb:"iso_code"`
+			Names   map[string]string `maxminddb:"names"`
+		} `maxminddb:"subdivisions"`
 		City struct {
 			Names map[string]string `maxminddb:"names"`
 		} `maxminddb:"city"`
 		Location struct {
-			Latitude  float64 `maxminddb:"latitude"`
-			Longitude float64 `maxminddb:"longitude"`
-			TimeZone  string  `maxminddb:"time_zone"`
+			AccuracyRadius uint16  `maxminddb:"accuracy_radius"`
+			Latitude       float64 `maxminddb:"latitude"`
+			Longitude      float64 `maxminddb:"longitude"`
+			TimeZone       string  `maxminddb:"time_zone"`
 		} `maxminddb:"location"`
 		Postal struct {
 			Code string `maxminddb:"code"`
 		} `maxminddb:"postal"`
 	}
 
-	err = db.Lookup(ipParsed, &record)
+	err := g.city.lookup(ip, &record)
 	if err != nil {
-		log.Println(err)
-		return Location{}
+		return err
+	}
+	location.ContinentCode = record.Continent.Code
+	location.CountryCode = record.Country.ISOCode
+	location.PostalCode = record.Postal.Code
+	location.AccuracyRadius = record.Location.AccuracyRadius
+	location.Latitude = record.Location.Latitude
+	location.Longitude = record.Location.Longitude
+	location.TimeZone = record.Location.TimeZone
+	for _, subdivision := range record.Subdivisions {
+		location.Subdivisions = append(location.Subdivisions, Subdivision{Code: subdivision.ISOCode})
+		names.subdivisions = append(names.subdivisions, subdivision.Names)
+	}
+	names.continent = record.Continent.Names
+	names.country = record.Country.Names
+	names.city = record.City.Names
+	return nil
+}
+
+// lookupASN fills the autonomous system of network from the ASN database.
+func (g *GeoIP) lookupASN(ip net.IP, network *Network) error {
+	var record struct {
+		Number       uint   `maxminddb:"autonomous_system_number"`
+		Organization string `maxminddb:"autonomous_system_organization"`
+	}
+
+	err := g.asn.lookup(ip, &record)
+	if err != nil {
+		return err
 	}
+	network.ASN = record.Number
+	network.ASOrganization = record.Organization
+	return nil
+}
+
+// lookupAnonymous fills the anonymizer flags of network from the anonymous IP database.
+func (g *GeoIP) lookupAnonymous(ip net.IP, network *Network) error {
+	var record struct {
+		IsAnonymous        bool `maxminddb:"is_anonymous"`
+		IsAnonymousVPN     bool `maxminddb:"is_anonymous_vpn"`
+		IsHostingProvider  bool `maxminddb:"is_hosting_provider"`
+		IsPublicProxy      bool `maxminddb:"is_public_proxy"`
+		IsResidentialProxy bool `maxminddb:"is_residential_proxy"`
+		IsTorExitNode      bool `maxminddb:"is_tor_exit_node"`
+	}
+
+	err := g.anonymous.lookup(ip, &record)
+	if err != nil {
+		return err
+	}
+	network.IsAnonymous = record.IsAnonymous
+	network.IsAnonymousVPN = record.IsAnonymousVPN
+	network.IsHostingProvider = record.IsHostingProvider
+	network.IsPublicProxy = record.IsPublicProxy
+	network.IsResidentialProxy = record.IsResidentialProxy
+	network.IsTorExitNode = record.IsTorExitNode
+	return nil
+}
+
+// Check verifies that every configured database is loaded and is not empty, so
+// that sessions are not silently stored without a location.
+func (g *GeoIP) Check(ctx context.Context) error {
+	var err error
+	for _, db := range g.databases() {
+		err = errors.Join(err, db.check())
+	}
+	return err
+}
+
+// Watch checks the database files every cfg.ReloadInterval until ctx is cancelled
+// and swaps in the databases whose file has changed. A file must be replaced by
+// renaming a complete copy over it, as geoipupdate does; a file rewritten in
+// place would change under the memory mapped reader.
+func (g *GeoIP) Watch(ctx context.Context) {
+	if g.cfg.ReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(g.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, db := range g.databases() {
+				reloaded, err := db.reload()
+				if err != nil {
+					logger.ErrorContext(ctx, "Watch: failed to reload the GeoIP database, keeping the previous one", "path", db.path, "error", err)
+				} else if reloaded {
+					g.cache.clear()
+					logger.InfoContext(ctx, "Watch: reloaded the GeoIP database", "path", db.path)
+				}
+			}
+		}
+	}
+}
 
-	location := Location{
-		Country:     record.Country.Names["en"],
-		CountryCode: record.Country.ISOCode,
-		City:        record.City.Names["en"],
-		PostalCode:  record.Postal.Code,
-		Latitude:    record.Location.Latitude,
-		Longitude:   record.Location.Longitude,
-		TimeZone:    record.Location.TimeZone,
+// Close releases the databases.
+func (g *GeoIP) Close() error {
+	var err error
+	for _, db := range g.databases() {
+		err = errors.Join(err, db.close())
 	}
-	return location
+	return err
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache keeps the locations of the most recently looked up IPs, since the
+// same client is usually located several times per registration and sign in.
+// A cache of size 0 keeps nothing.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruEntry is an element of lruCache.order.
+type lruEntry struct {
+	ip       string
+	location cachedLocation
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the cached location of ip.
+func (c *lruCache) get(ip string) (cachedLocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[ip]
+	if !found {
+		return cachedLocation{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).location, true
+}
+
+// add caches the location of ip, evicting the least recently used entry when full.
+func (c *lruCache) add(ip string, location cachedLocation) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.entries[ip]; found {
+		element.Value.(*lruEntry).location = location
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[ip] = c.order.PushFront(&lruEntry{ip: ip, location: location})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).ip)
+	}
+}
+
+// clear empties the cache, e.g. when the database is replaced.
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdb is a MaxMind database file that can be replaced while it is in use.
+type mmdb struct {
+	path     string
+	inMemory bool
+
+	// mu guards db: lookups hold the read lock so a replaced reader is only
+	// closed, and its memory unmapped, once no lookup uses it anymore.
+	mu sync.RWMutex
+	db *maxminddb.Reader
+	// modTime and size identify the file db was last loaded, or failed to load, from.
+	modTime time.Time
+	size    int64
+	// loadErr is why the last load failed, failures how many loads of the
+	// same file failed in a row and retryAt when it is tried again.
+	loadErr  error
+	failures int
+	retryAt  time.Time
+}
+
+// Backoff of the retries of a file that failed to load, see mmdb.reload.
+const (
+	minReloadBackoff = time.Minute
+	maxReloadBackoff = time.Hour
+)
+
+// lookup decodes the record of ip into result.
+func (d *mmdb) lookup(ip net.IP, result any) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.db == nil {
+		return errors.New(d.path + " is not loaded")
+	}
+	return d.db.Lookup(ip, result)
+}
+
+// check verifies that the database is loaded and is not empty, and that its
+// file did not fail to load since: a replacement that fails to load is reported
+// even though lookups are still served by the previous database.
+func (d *mmdb) check() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.db == nil {
+		if d.loadErr != nil {
+			return fmt.Errorf("%s is not loaded after %d failures -> %w", d.path, d.failures, d.loadErr)
+		}
+		return errors.New(d.path + " is not loaded")
+	}
+	if d.loadErr != nil {
+		return fmt.Errorf("%s failed to reload %d times, serving the previous database -> %w", d.path, d.failures, d.loadErr)
+	}
+	if d.db.Metadata.DatabaseType == "" || d.db.Metadata.NodeCount == 0 {
+		return errors.New(d.path + " is empty")
+	}
+	return nil
+}
+
+// reload opens the database file when it differs from the loaded one and swaps it in.
+// It reports whether a new database was loaded. A file that failed to load is
+// tried again as soon as it changes, and otherwise after a backoff doubling from
+// minReloadBackoff to maxReloadBackoff, so that a corrupt file is not reopened on
+// every call; the error is kept for check in the meantime.
+func (d *mmdb) reload() (bool, error) {
+	now := time.Now()
+	info, err := os.Stat(d.path)
+	if err != nil {
+		d.failed(time.Time{}, 0, now, err)
+		return false, err
+	}
+	d.mu.RLock()
+	sameFile := info.ModTime().Equal(d.modTime) && info.Size() == d.size
+	retry := d.loadErr != nil && !now.Before(d.retryAt)
+	unchanged := sameFile && (d.db != nil || d.loadErr != nil) && !retry
+	d.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	db, err := d.open()
+	if err != nil {
+		d.failed(info.ModTime(), info.Size(), now, err)
+		return false, err
+	}
+
+	d.mu.Lock()
+	previous := d.db
+	d.db, d.modTime, d.size = db, info.ModTime(), info.Size()
+	d.loadErr, d.failures, d.retryAt = nil, 0, time.Time{}
+	d.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return true, nil
+}
+
+// failed records that the file identified by modTime and size failed to load at now with err.
+func (d *mmdb) failed(modTime time.Time, size int64, now time.Time, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !modTime.Equal(d.modTime) || size != d.size {
+		d.failures = 0
+	}
+	d.failures++
+	backoff := min(minReloadBackoff<<min(d.failures-1, 6), maxReloadBackoff)
+	d.modTime, d.size = modTime, size
+	d.loadErr, d.retryAt = err, now.Add(backoff)
+}
+
+// open opens the database file, memory mapped or read in memory as configured.
+func (d *mmdb) open() (*maxminddb.Reader, error) {
+	var (
+		db  *maxminddb.Reader
+		err error
+	)
+	if d.inMemory {
+		var data []byte
+		data, err = os.ReadFile(d.path)
+		if err == nil {
+			db, err = maxminddb.FromBytes(data)
+		}
+	} else {
+		db, err = maxminddb.Open(d.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if db.Metadata.NodeCount == 0 {
+		db.Close()
+		return nil, errors.New(d.path + " is empty")
+	}
+	return db, nil
+}
+
+// close releases the database.
+func (d *mmdb) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.db == nil {
+		return nil
+	}
+	err := d.db.Close()
+	d.db = nil
+	return err
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadBacksOffAFileThatFailsToLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	err := os.WriteFile(path, []byte("not a MaxMind database"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &mmdb{path: path}
+
+	reloaded, err := db.reload()
+	if reloaded || err == nil {
+		t.Fatalf("reload = %v, %v, want an error", reloaded, err)
+	}
+	loadErr := err
+	if err := db.check(); err == nil || !strings.Contains(err.Error(), loadErr.Error()) {
+		t.Errorf("check = %v, want the load error %v", err, loadErr)
+	}
+
+	// the same file is not reopened before its backoff
+	reloaded, err = db.reload()
+	if reloaded || err != nil || db.failures != 1 {
+		t.Errorf("reload = %v, %v after %d failures, want the file skipped", reloaded, err, db.failures)
+	}
+	if backoff := time.Until(db.retryAt); backoff <= 0 || backoff > minReloadBackoff {
+		t.Errorf("retried in %v, want within %v", backoff, minReloadBackoff)
+	}
+
+	db.retryAt = time.Now()
+	if _, err = db.reload(); err == nil || db.failures != 2 {
+		t.Errorf("reload = %v after %d failures, want the file retried once its backoff is over", err, db.failures)
+	}
+	if backoff := time.Until(db.retryAt); backoff <= minReloadBackoff || backoff > 2*minReloadBackoff {
+		t.Errorf("retried in %v, want the backoff doubled", backoff)
+	}
+
+	// a new file is tried at once
+	err = os.WriteFile(path, []byte("still not a MaxMind database"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.reload(); err == nil || db.failures != 1 {
+		t.Errorf("reload = %v after %d failures, want the changed file tried at once", err, db.failures)
+	}
+}
+
+func TestCheckReportsAReplacementThatFailsToLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	writeMMDB(t, path, "GeoLite2-City")
+	db := &mmdb{path: path}
+	if reloaded, err := db.reload(); !reloaded || err != nil {
+		t.Fatalf("reload = %v, %v, want the database loaded", reloaded, err)
+	}
+	if err := db.check(); err != nil {
+		t.Fatalf("check = %v, want the loaded database ready", err)
+	}
+
+	// replaced like geoipupdate does, the previous file stays mapped
+	replacement := path + ".new"
+	err := os.WriteFile(replacement, []byte("a truncated MaxMind database"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	_, loadErr := db.reload()
+	if loadErr == nil {
+		t.Fatal("reload succeeded, want the replacement to fail")
+	}
+	var record struct{}
+	if err := db.lookup(net.ParseIP("1.2.3.4"), &record); err != nil {
+		t.Errorf("lookup = %v, want the previous database kept", err)
+	}
+	if err := db.check(); err == nil || !strings.Contains(err.Error(), loadErr.Error()) || !strings.Contains(err.Error(), "1 times") {
+		t.Errorf("check = %v, want the load error %v after 1 failure", err, loadErr)
+	}
+}
+
+// writeMMDB writes to path a MaxMind database of type databaseType holding no
+// record: a single node of 24 bit records, followed by its metadata.
+func writeMMDB(t *testing.T, path, databaseType string) {
+	t.Helper()
+	// both records of the node point past the tree, to no data
+	file := []byte{0, 0, 1, 0, 0, 1}
+	file = append(file, make([]byte, 16)...)
+	file = append(file, "\xab\xcd\xefMaxMind.com"...)
+	// a map of 5 entries keyed by strings, the values are 1 byte unsigned integers but for database_type
+	file = append(file, 0xe5)
+	field := func(key string, value ...byte) {
+		file = append(file, 0x40|byte(len(key)))
+		file = append(file, key...)
+		file = append(file, value...)
+	}
+	field("node_count", 0xc1, 1)
+	field("record_size", 0xa1, 24)
+	field("ip_version", 0xa1, 4)
+	field("binary_format_major_version", 0xa1, 2)
+	field("database_type", append([]byte{0x40 | byte(len(databaseType))}, databaseType...)...)
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
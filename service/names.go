@@ -0,0 +1,72 @@
+package service
+
+import "strings"
+
+// defaultLanguage is used for the names that are not available in any of the
+// preferred languages. Every place of the MaxMind databases has an English name.
+const defaultLanguage = "en"
+
+// placeNames holds the names of the places of a location in every language of
+// the City database, keyed by language tag, e.g. "en", "pt-BR" or "zh-CN".
+type placeNames struct {
+	continent    map[string]string
+	country      map[string]string
+	subdivisions []map[string]string
+	city         map[string]string
+}
+
+// cachedLocation is a located IP before its names are localized, so that one
+// cache entry serves clients of every language.
+type cachedLocation struct {
+	location Location
+	names    placeNames
+}
+
+// localize returns the location with its names in the first of languages in
+// which they are available.
+func (cached cachedLocation) localize(languages []string) Location {
+	location := cached.location
+	location.Continent = localizedName(cached.names.continent, languages)
+	location.Country = localizedName(cached.names.country, languages)
+	location.City = localizedName(cached.names.city, languages)
+	// the subdivisions are copied, the cached ones are shared between lookups
+	location.Subdivisions = make([]Subdivision, len(cached.location.Subdivisions))
+	for i, subdivision := range cached.location.Subdivisions {
+		subdivision.Name = localizedName(cached.names.subdivisions[i], languages)
+		location.Subdivisions[i] = subdivision
+	}
+	if len(location.Subdivisions) > 0 {
+		location.State = location.Subdivisions[0].Name
+		location.StateCode = location.Subdivisions[0].Code
+	} else {
+		location.Subdivisions = nil
+	}
+	return location
+}
+
+// localizedName returns the name in the first of languages in which it is
+// available, falling back to English. A language matches a name of the same
+// tag, ignoring case, or else of the same base language, so "pt" and "pt-PT"
+// match "pt-BR". Among several of the same base the smallest tag wins.
+func localizedName(names map[string]string, languages []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	for _, language := range languages {
+		base, _, _ := strings.Cut(language, "-")
+		var sameBase string
+		for tag := range names {
+			if strings.EqualFold(tag, language) {
+				return names[tag]
+			}
+			tagBase, _, _ := strings.Cut(tag, "-")
+			if strings.EqualFold(tagBase, base) && (sameBase == "" || tag < sameBase) {
+				sameBase = tag
+			}
+		}
+		if sameBase != "" {
+			return names[sameBase]
+		}
+	}
+	return names[defaultLanguage]
+}
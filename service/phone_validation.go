@@ -1,66 +1,143 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"net/http"
 	"strings"
-	"we-credit/utility"
+	"time"
+	"we-credit/config"
+	"we-credit/metrics"
+	"we-credit/tracing"
 
-	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	LookupsV1 "github.com/twilio/twilio-go/rest/lookups/v1"
 	lookupsV2 "github.com/twilio/twilio-go/rest/lookups/v2"
 )
 
+// twilioTimeout bounds every call to the Twilio API, as the default client of twilio-go does.
+const twilioTimeout = 10 * time.Second
+
+// Twilio looks up phone numbers and sends SMS through the Twilio API.
+type Twilio struct {
+	accountSID string
+	authToken  string
+	fromNumber string
+	// transport sends the HTTP calls to Twilio, see requestHandler.
+	transport http.RoundTripper
+}
+
+// NewTwilio returns a Twilio service authenticated with the configured account.
+func NewTwilio(cfg config.TwilioConfig) *Twilio {
+	return &Twilio{
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		fromNumber: cfg.FromNumber,
+		transport:  http.DefaultTransport,
+	}
+}
+
+// requestHandler returns the Twilio client for a single call made on behalf of ctx.
+// The twilio-go services take no context, so it is bound to the HTTP requests by the
+// transport: they carry the trace of the span in ctx, and are cancelled with it.
+// The calls are not traced at the HTTP level, as the URLs of the lookups hold the
+// phone number; the span of every call is started by its caller instead.
+func (t *Twilio) requestHandler(ctx context.Context) *client.RequestHandler {
+	c := &client.Client{
+		Credentials: client.NewCredentials(t.accountSID, t.authToken),
+		HTTPClient: &http.Client{
+			Transport: contextTransport{ctx: ctx, next: t.transport},
+			Timeout:   twilioTimeout,
+			// like the default client of twilio-go, redirects are returned rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	c.SetAccountSid(t.accountSID)
+	return client.NewRequestHandler(c)
+}
+
+// contextTransport sends every request with ctx and the trace context headers of its span.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(t.ctx)
+	otel.GetTextMapPropagator().Inject(t.ctx, propagation.HeaderCarrier(req.Header))
+	return t.next.RoundTrip(req)
+}
+
+// CheckConfigured verifies that the credentials and the sender number needed to send SMS are set.
+// It does not call the Twilio API, so that probes neither cost money nor depend on Twilio being up.
+func (t *Twilio) CheckConfigured(ctx context.Context) error {
+	var missing []string
+	if t.accountSID == "" {
+		missing = append(missing, "account sid")
+	}
+	if t.authToken == "" {
+		missing = append(missing, "auth token")
+	}
+	if t.fromNumber == "" {
+		missing = append(missing, "from number")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("twilio %s not configured", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // IsPhNumberDeliverable checks if a given phone number is deliverable by using Twilio's Lookup API.
 // Parameters:
+// - ctx: The context of the request, used for logging.
 // - phone: The phone number to be checked, in E.164 format (e.g., "+14155552671").
 // - countrycode: The country code of the phone number, in ISO 3166-1 alpha-2 format (e.g., "US").
 // Returns:
-// - bool: True if the phone number is deliverable, false otherwise.
+// - bool: True if the phone number is deliverable, false if Twilio does not know it.
 // - error: An error if the lookup fails or if there is an issue with the Twilio API.
-func IsPhNumberDeliverable(phone, countrycode string) (bool, error) {
-
-	accountSid := os.Getenv("TWILIO_ACCOUNT_SID")
-	authToken := os.Getenv("TWILIO_ACCOUNT_AUTH_TOKEN")
-
-	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: accountSid,
-		Password: authToken,
-	})
+func (t *Twilio) IsPhNumberDeliverable(ctx context.Context, phone, countrycode string) (bool, error) {
 
 	params := &LookupsV1.FetchPhoneNumberParams{}
 	params.SetCountryCode(countrycode)
 
 	params.SetType([]string{"carrier"})
-	_, err := client.LookupsV1.FetchPhoneNumber(phone, params)
+	spanCtx, span := tracer.Start(ctx, "twilio lookups.v1 carrier", trace.WithSpanKind(trace.SpanKindClient))
+	_, err := LookupsV1.NewApiService(t.requestHandler(spanCtx)).FetchPhoneNumber(phone, params)
+	tracing.End(span, err)
+	// Twilio answers 404 for the numbers that do not exist, any other error leaves the number unchecked
+	var restErr *client.TwilioRestError
+	if errors.As(err, &restErr) && restErr.Status == http.StatusNotFound {
+		logger.InfoContext(ctx, "IsPhNumberDeliverable: the phone number is unknown to Twilio", "error", err)
+		metrics.PhoneLookups.WithLabelValues("deliverability", "undeliverable").Inc()
+		return false, nil
+	}
 	if err != nil {
-		log.Println("IsPhNumberDeliverable : The phone number lookup failed, with error:", err)
+		logger.ErrorContext(ctx, "IsPhNumberDeliverable: the phone number lookup failed", "error", err)
+		metrics.PhoneLookups.WithLabelValues("deliverability", "error").Inc()
 		return false, err
 	}
 
+	metrics.PhoneLookups.WithLabelValues("deliverability", "deliverable").Inc()
 	return true, nil
 }
 
 // IsPhoneNumberVoip checks if the given phone number is a VoIP number or not using Twilio's Lookup API.
 // Parameters:
+// - ctx: The context of the request, used for logging.
 // - phone: The phone number to be checked, in E.164 format (e.g., "+14155552671").
 // - countrycode: The country code of the phone number, in ISO 3166-1 alpha-2 format (e.g., "US").
 // Returns:
 // - bool: True if the phone number is a VoIP number, false otherwise.
 // - error: An error if the lookup fails or if there is an issue with the Twilio API.
-func IsPhoneNumberVoip(phone, countrycode string) (bool, error) {
-	// Retrieve Twilio Account SID and Auth Token from utility functions
-	accountSid := utility.GetTwilioAccountID()
-	authToken := utility.GetTwilioAuthorizationToken()
-	// Create a new Twilio Rest Client with the provided Account SID and Auth Token
-
-	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: accountSid,
-		Password: authToken,
-	})
+func (t *Twilio) IsPhoneNumberVoip(ctx context.Context, phone, countrycode string) (bool, error) {
 	// Initialize parameters for the phone number lookup
 
 	params := &lookupsV2.FetchPhoneNumberParams{}
@@ -68,66 +145,73 @@ func IsPhoneNumberVoip(phone, countrycode string) (bool, error) {
 	params.SetFields("line_type_intelligence")
 	// Fetch phone number details using the Twilio Lookup API
 
-	resp, err := client.LookupsV2.FetchPhoneNumber(phone, params)
+	spanCtx, span := tracer.Start(ctx, "twilio lookups.v2 line_type_intelligence", trace.WithSpanKind(trace.SpanKindClient))
+	resp, err := lookupsV2.NewApiService(t.requestHandler(spanCtx)).FetchPhoneNumber(phone, params)
+	tracing.End(span, err)
 	if err != nil {
-		log.Println("IsPhoneNumberVoip : The phone number lookup failed, with error:", err)
+		logger.ErrorContext(ctx, "IsPhoneNumberVoip: the phone number lookup failed", "error", err)
+		metrics.PhoneLookups.WithLabelValues("line_type", "error").Inc()
 		return true, err
 	}
 	if resp.LineTypeIntelligence != nil {
 		// Type assertion to extract line type intelligence data as a map
 		lineTypeIntelligenceValue, ok := (*resp.LineTypeIntelligence).(map[string]interface{})
 		if !ok {
-			log.Println("IsPhoneNumberVoip: failed due to Invalid LineTypeIntelligence format")
+			logger.ErrorContext(ctx, "IsPhoneNumberVoip: failed due to invalid LineTypeIntelligence format")
+			metrics.PhoneLookups.WithLabelValues("line_type", "error").Inc()
 			return true, err
 		}
 		// Extract the line type from the line type intelligence data
 
 		if lineType, ok := lineTypeIntelligenceValue["type"].(string); ok {
-			log.Println("lineType", lineType)
+			logger.DebugContext(ctx, "IsPhoneNumberVoip: line type", "line_type", lineType)
 			if lineType != "nonFixedVoip" {
+				metrics.PhoneLookups.WithLabelValues("line_type", "not_voip").Inc()
 				return false, nil
 			}
 		}
 	} else {
+		metrics.PhoneLookups.WithLabelValues("line_type", "not_voip").Inc()
 		return false, nil
 	}
+	metrics.PhoneLookups.WithLabelValues("line_type", "voip").Inc()
 	return true, nil
 }
 
 // SendMessage sends an SMS message to a specified phone number using the Twilio API.
 // Parameters:
+// - ctx: The context of the request, used for logging.
 // - phone: The recipient's phone number (without the country code).
 // - message: The content of the SMS message to be sent.
 // - dialingCode: The international dialing code for the recipient's country (e.g., "+1" for the US).
 // Returns:
 // - error: Returns an error if the message sending fails, otherwise returns nil.
-func SendMessage(phone string, message string, dialingCode string) error {
+func (t *Twilio) SendMessage(ctx context.Context, phone string, message string, dialingCode string) error {
 
 	phone = fmt.Sprintf("%s%s", dialingCode, phone)
 	if !strings.HasPrefix(phone, "+") {
 		phone = fmt.Sprintf("+%s", phone)
 	}
 
-	accountSid := os.Getenv("TWILIO_ACCOUNT_SID")
-	authToken := os.Getenv("TWILIO_ACCOUNT_AUTH_TOKEN")
-	twilioFrom := os.Getenv("TWILIO_FROM_NUMBER")
-
-	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: accountSid,
-		Password: authToken,
-	})
-
 	params := &openapi.CreateMessageParams{}
 
 	params.SetTo(phone)
-	params.SetFrom(twilioFrom)
+	params.SetFrom(t.fromNumber)
 	params.SetBody(message)
-	_, err := client.Api.CreateMessage(params)
+	spanCtx, span := tracer.Start(ctx, "twilio messages.create", trace.WithSpanKind(trace.SpanKindClient))
+	_, err := openapi.NewApiService(t.requestHandler(spanCtx)).CreateMessage(params)
+	tracing.End(span, err)
 
+	country := "+" + strings.TrimPrefix(dialingCode, "+")
+	if country == "+" {
+		country = "unknown"
+	}
 	if err != nil {
-		log.Println("SendMessage : failed while sending message to the tutree user, with error:", err)
+		logger.ErrorContext(ctx, "SendMessage: failed while sending message to the tutree user", "error", err)
+		metrics.OTPSends.WithLabelValues("sms", "twilio", country, "failed").Inc()
 		return err
 	}
 
+	metrics.OTPSends.WithLabelValues("sms", "twilio", country, "sent").Inc()
 	return nil
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"we-credit/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// roundTripFunc answers the requests of the Twilio client without calling Twilio.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTwilioCallsCarryTheRequestContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	var requests []*http.Request
+	twilio := &Twilio{
+		accountSID: "AC123",
+		authToken:  "secret",
+		fromNumber: "+15005550006",
+		transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, req)
+			if strings.Contains(req.URL.Path, "/PhoneNumbers/") {
+				// Twilio quotes the number it does not know
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"code": 20404, "message": "The requested resource ` + req.URL.Path + ` was not found", "status": 404}`)),
+					Request:    req,
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"sid": "SM123"}`)),
+				Request:    req,
+			}, nil
+		}),
+	}
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "POST /api/v1/user/otp/send")
+	err := twilio.SendMessage(ctx, "4155550100", "1234 is your code", "+1")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if _, err := twilio.IsPhoneNumberVoip(ctx, "4155550100", "US"); err == nil {
+		t.Fatalf("IsPhoneNumberVoip succeeded, want the lookup of an unknown number to fail")
+	}
+	request.End()
+	if len(requests) != 2 || !strings.HasSuffix(requests[0].URL.Path, "/Accounts/AC123/Messages.json") {
+		t.Fatalf("requests = %v, want a POST to the Messages of AC123 then a lookup", requests)
+	}
+	if got := trace.SpanContextFromContext(requests[0].Context()).TraceID(); got != request.SpanContext().TraceID() {
+		t.Errorf("the Twilio request is in trace %s, want the trace of the request %s", got, request.SpanContext().TraceID())
+	}
+
+	// request > twilio messages.create, propagated to Twilio
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		spans[span.Name()] = span
+	}
+	create, found := spans["twilio messages.create"]
+	if !found || create.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatalf("spans = %v, want twilio messages.create under the request span", spans)
+	}
+	if got := requests[0].Header.Get("traceparent"); !strings.Contains(got, create.SpanContext().SpanID().String()) {
+		t.Errorf("traceparent = %q, want the span %s of twilio messages.create", got, create.SpanContext().SpanID())
+	}
+
+	// the lookup URLs and errors hold the phone number, which must not be exported
+	for _, span := range spans {
+		attributes := span.Attributes()
+		for _, event := range span.Events() {
+			attributes = append(attributes, event.Attributes...)
+		}
+		for _, attribute := range attributes {
+			if strings.Contains(attribute.Value.Emit(), "4155550100") {
+				t.Errorf("span %s has %s = %q, want the phone number left out", span.Name(), attribute.Key, attribute.Value.Emit())
+			}
+		}
+		if strings.Contains(span.Status().Description, "4155550100") {
+			t.Errorf("span %s has status %q, want the phone number left out", span.Name(), span.Status().Description)
+		}
+	}
+	if lookup, found := spans["twilio lookups.v2 line_type_intelligence"]; !found || len(lookup.Events()) == 0 {
+		t.Errorf("spans = %v, want the failed lookup with its error recorded", spans)
+	}
+}
+
+func TestTwilioCallsAreCancelledWithTheRequest(t *testing.T) {
+	twilio := &Twilio{
+		accountSID: "AC123",
+		authToken:  "secret",
+		transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := twilio.IsPhNumberDeliverable(ctx, "4155550100", "US")
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("IsPhNumberDeliverable = %v, want the call cancelled with its context", err)
+	}
+}
+
+func TestIsPhNumberDeliverable(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		deliverable bool
+		wantErr     bool
+		result      string
+	}{
+		{"deliverable", http.StatusOK, `{"phone_number": "+14155550100"}`, true, false, "deliverable"},
+		{"unknown number", http.StatusNotFound, `{"code": 20404, "message": "The requested resource was not found", "status": 404}`, false, false, "undeliverable"},
+		{"provider failure", http.StatusServiceUnavailable, `{"code": 20503, "message": "Service unavailable", "status": 503}`, false, true, "error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			twilio := &Twilio{
+				accountSID: "AC123",
+				authToken:  "secret",
+				transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: test.status,
+						Header:     http.Header{"Content-Type": []string{"application/json"}},
+						Body:       io.NopCloser(strings.NewReader(test.body)),
+						Request:    req,
+					}, nil
+				}),
+			}
+			counter := metrics.PhoneLookups.WithLabelValues("deliverability", test.result)
+			before := testutil.ToFloat64(counter)
+
+			deliverable, err := twilio.IsPhNumberDeliverable(context.Background(), "4155550100", "US")
+			if deliverable != test.deliverable || (err != nil) != test.wantErr {
+				t.Errorf("IsPhNumberDeliverable = %v, %v, want %v and an error: %v", deliverable, err, test.deliverable, test.wantErr)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("phone_lookups_total{result=%q} grew by %v, want 1", test.result, got)
+			}
+		})
+	}
+}
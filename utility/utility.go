@@ -1,53 +1,43 @@
 package utility
 
 import (
-	"log"
 	"math/rand"
-	"os"
-	"strconv"
 	"time"
+	"we-credit/clientip"
+	"we-credit/config"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
 )
 
-// GetHostURL get host url
-func GetHostURL() string {
-	return os.Getenv("HOST_URL")
-}
-func GetClientIP(c *gin.Context) string {
-	clientIP := c.ClientIP()
-	if os.Getenv("ENV") == "local" {
-		clientIP = os.Getenv("LOCAL_IP")
+// GetClientIP returns the ip address of the client, resolved behind the trusted
+// proxies by clientip.Middleware. On a developer machine (ENV=local) the
+// configured LOCAL_IP is returned instead, so GeoIP lookups work.
+func GetClientIP(c *gin.Context, server config.ServerConfig) string {
+	clientIP := clientip.Get(c).IP
+	if server.IsLocal() {
+		clientIP = server.LocalIP
 	}
 	return clientIP
 }
 
-// input: no parameter
-// output: bool
-// func GetTwilioAccountID will check whether voip numbers on the server is allowed or not.
-func AllowVoipNumbers() bool {
-	isAllowed, err := strconv.ParseBool(os.Getenv("ALLOW_VOIP_NUMBERS"))
+// PreferredLanguages returns the languages of the Accept-Language header of the
+// request, most preferred first, e.g. ["fr-CH", "fr", "en"]. Languages the client
+// refuses (q=0) and the wildcard are left out.
+func PreferredLanguages(c *gin.Context) []string {
+	tags, weights, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
 	if err != nil {
-		log.Println("[ENV-MISSING] AllowVoipNumbers: failed while fetching .env variable for voip number")
-		return true
+		return nil
 	}
-	return isAllowed
-}
-
-// input: no parameter
-// output: string
-// func GetTwilioAccountID will return twilio account sid which will be used for calling twilio api service
-func GetTwilioAccountID() string {
-	accountSid := os.Getenv("TWILIO_ACCOUNT_SID")
-	return accountSid
-}
-
-// input: no parameter
-// output: string
-// func GetTwilioAccountID will return twilio account authorization token which will be used for calling twilio api service
-func GetTwilioAuthorizationToken() string {
-	authToken := os.Getenv("TWILIO_ACCOUNT_AUTH_TOKEN")
-	return authToken
+	languages := make([]string, 0, len(tags))
+	for i, tag := range tags {
+		// the wildcard is parsed as "mul", multiple languages
+		if weights[i] <= 0 || tag == language.Und || tag.String() == "mul" {
+			continue
+		}
+		languages = append(languages, tag.String())
+	}
+	return languages
 }
 
 // generateOTP